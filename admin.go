@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+func isAdminRequest(c *gin.Context) bool {
+	entry, ok := requestToken(c)
+	return ok && entry.Role == roleAdmin
+}
+
+// requireAdmin rejects requests that aren't made with an admin token, either
+// ADMIN_API_TOKEN or an API_TOKENS entry with role admin. It guards /admin/*,
+// POST /sku-lists and /exports; see the route table in main.go.
+var requireAdmin = requireRole(roleAdmin)
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postWarmSku serves POST /admin/warm/:sku_id. It always runs the single-SKU
+// query, even if the SKU is cached, and stores the result so the next
+// /sku-metrics/:sku_id request with the same ?sold_months= is a cache hit.
+// Like fetchSkuMetricsSingle, it doesn't store an empty result.
+func postWarmSku(c *gin.Context) {
+	skuId := normalizeSkuID(c.Param("sku_id"))
+
+	var v validator
+	soldMonths := parseSoldMonths(c, &v, "SKU_METRICS_MAX_SOLD_MONTHS")
+	if v.respond(c) {
+		return
+	}
+
+	start := time.Now()
+	results, err := querySkuMetricsSingle(c.Request.Context(), skuId, soldMonths)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	ttl := skuMetricsSingleTTL()
+	if len(results.Rows) > 0 {
+		skuMetricsSingleCache.set(skuMetricsSingleKey(skuId, soldMonths), results, ttl)
+	}
+	duration := time.Since(start)
+
+	loggerFrom(c.Request.Context()).Info("Warmed SKU", "sku", skuId, "rows", len(results.Rows), "duration_ms", duration.Milliseconds())
+	c.JSON(http.StatusOK, gin.H{
+		"sku":         skuId,
+		"sold_months": soldMonths,
+		"rows":        len(results.Rows),
+		"duration_ms": duration.Milliseconds(),
+		"ttl_seconds": int(ttl.Seconds()),
+	})
+}
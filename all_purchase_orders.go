@@ -2,39 +2,136 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"strconv"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/api/iterator"
 )
 
-func getAllPurchaseOrders(c *gin.Context) {
-	fmt.Println("All purchase orders requested")
-	ctx := context.Background()
-
-	query := bqClient.Query(`
+// allPurchaseOrdersCTE drops placeholder items (product_id 0) from each
+// purchase order unless @include_placeholder_items is set, and items not
+// stocked in @warehouse when it is non-empty. It keeps only orders inside
+// the @delivery_from/@delivery_to window when those are non-empty. It is
+// shared by the list query and the totals query so both agree on what
+// counts as an item.
+const allPurchaseOrdersCTE = `
 		WITH filtered_items AS (
 			SELECT * EXCEPT(items),
 				ARRAY(
 					SELECT AS STRUCT * 
 					FROM UNNEST(items) 
-					WHERE product_id != 0
+					WHERE (product_id != 0 OR @include_placeholder_items)
+					  AND (@warehouse = '' OR product_id IN (` + warehouseProductsSQL + `))
 				) as items
 			FROM metal-force-400307.agent.purchase_orders
-		)
-		SELECT * FROM filtered_items
+			WHERE (@delivery_from = '' OR delivery_date >= @delivery_from)
+			  AND (@delivery_to = '' OR delivery_date <= @delivery_to)
+		)`
+
+type purchaseOrderTotals struct {
+	pos   int64
+	items int64
+	err   error
+}
+
+// includePlaceholderItems reads ?include_placeholder_items=true, the opt-in
+// shared by all purchase-order endpoints to keep items with product_id 0.
+func includePlaceholderItems(c *gin.Context) bool {
+	return c.Query("include_placeholder_items") == "true"
+}
+
+func placeholderItemsParameter(include bool) bigquery.QueryParameter {
+	return bigquery.QueryParameter{Name: "include_placeholder_items", Value: include}
+}
+
+// warehouseProductsSQL selects the products stocked in @warehouse at the
+// latest inventory snapshot. agent.purchase_orders has no destination
+// warehouse, so ?warehouse= takes it from stg_xentral__inventory, the table
+// ?by_warehouse= splits stock by: an item counts as inbound to the
+// warehouses that already stock its product.
+const warehouseProductsSQL = `
+			SELECT i.product_id
+			FROM metal-force-400307.staging.stg_xentral__inventory i
+			WHERE i.warehouse = @warehouse
+			  AND i.date = (
+			    SELECT MAX(date)
+			    FROM metal-force-400307.staging.stg_xentral__inventory
+			    WHERE warehouse IS NOT NULL
+			  )`
+
+// warehouseParameter binds ?warehouse=, the warehouse filter shared by all
+// purchase-order endpoints (see warehouseProductsSQL). An empty value
+// matches every warehouse.
+func warehouseParameter(c *gin.Context) bigquery.QueryParameter {
+	return bigquery.QueryParameter{Name: "warehouse", Value: c.Query("warehouse")}
+}
+
+func countPurchaseOrders(ctx context.Context, params []bigquery.QueryParameter) purchaseOrderTotals {
+	query, err := newQuery(allPurchaseOrdersCTE + `
+		SELECT
+			COUNT(*) AS total_pos,
+			COALESCE(SUM(ARRAY_LENGTH(items)), 0) AS total_items
+		FROM filtered_items
 		WHERE ARRAY_LENGTH(items) > 0
 	`)
+	if err != nil {
+		return purchaseOrderTotals{err: err}
+	}
+	query.Parameters = params
 
-	it, err := query.Read(ctx)
+	it, err := readQuery(ctx, query)
 	if err != nil {
-		fmt.Printf("BigQuery error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to query BigQuery",
-			"details": err.Error(),
-		})
+		return purchaseOrderTotals{err: err}
+	}
+
+	var row struct {
+		TotalPOs   int64 `bigquery:"total_pos"`
+		TotalItems int64 `bigquery:"total_items"`
+	}
+	if err := it.Next(&row); err != nil {
+		return purchaseOrderTotals{err: err}
+	}
+	return purchaseOrderTotals{pos: row.TotalPOs, items: row.TotalItems}
+}
+
+func getAllPurchaseOrders(c *gin.Context) {
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("All purchase orders requested")
+
+	var v validator
+	filters := purchaseOrderFilters(c, &v, "ALL_PURCHASE_ORDERS_MAX_DELIVERY_WINDOW_MONTHS")
+	page := parsePagination(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	// Offset paging needs a total order; id breaks delivery_date ties
+	query, err := newQuery(allPurchaseOrdersCTE + `
+		SELECT * FROM filtered_items
+		WHERE ARRAY_LENGTH(items) > 0
+		ORDER BY delivery_date, id
+		` + page.clause())
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	query.Parameters = append(page.parameters(), filters...)
+
+	// Totals are optional because they cost a second BigQuery job; run the count
+	// alongside the page query so it doesn't add to the response time
+	var totals chan purchaseOrderTotals
+	if c.Query("include_totals") == "true" {
+		totals = make(chan purchaseOrderTotals, 1)
+		go func() {
+			totals <- countPurchaseOrders(ctx, filters)
+		}()
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		respondQueryError(c, err)
 		return
 	}
 
@@ -47,17 +144,31 @@ func getAllPurchaseOrders(c *gin.Context) {
 			break
 		}
 		if err != nil {
-			fmt.Printf("Error reading row: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to read BigQuery results",
-				"details": err.Error(),
-			})
+			loggerFrom(ctx).Error("Error reading row", "error", err)
+			respondQueryError(c, err)
 			return
 		}
+		for _, field := range it.Schema {
+			row[field.Name] = convertValue(field, row[field.Name])
+		}
 		results = append(results, row)
 	}
 
-	fmt.Printf("Returning %d purchase orders in raw BigQuery format\n", len(results))
+	total := -1
+	if totals != nil {
+		t := <-totals
+		if t.err != nil {
+			loggerFrom(ctx).Error("BigQuery totals error", "error", t.err)
+			respondQueryError(c, t.err)
+			return
+		}
+		c.Header("X-Total-POs", strconv.FormatInt(t.pos, 10))
+		c.Header("X-Total-Items", strconv.FormatInt(t.items, 10))
+		total = int(t.pos)
+	}
+	page.setLinkHeader(c, len(results), total)
+
+	loggerFrom(ctx).Info("Returning purchase orders in raw BigQuery format", "rows", len(results))
 	c.Header("Cache-Control", "private, max-age=300")
-	c.JSON(http.StatusOK, results)
+	respondJSON(c, http.StatusOK, results)
 } 
\ No newline at end of file
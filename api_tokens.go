@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	roleRead  = "read"
+	roleAdmin = "admin"
+)
+
+// apiKeyHeader carries the token for clients that can't set Authorization. It
+// is checked exactly like a bearer token but only when Authorization is absent.
+const apiKeyHeader = "X-Api-Key"
+
+// authTokenKey is the gin context key the auth middleware stores the
+// caller's apiToken under.
+const authTokenKey = "auth_token"
+
+// apiToken is a configured bearer token. Logs name a token by its alias and
+// never print the token itself; a rejected token, which has no alias, is
+// logged through redactedToken.
+type apiToken struct {
+	Alias string
+	Role  string
+}
+
+// apiTokens maps each accepted bearer token to its alias and role.
+var apiTokens = map[string]apiToken{}
+
+// loadAPITokens reads the accepted tokens at startup: API_TOKEN (role read),
+// ADMIN_API_TOKEN (role admin), and API_TOKENS as comma-separated
+// alias:token:role triples. It panics on a malformed list so a bad deploy
+// fails immediately.
+func loadAPITokens() {
+	tokens := map[string]apiToken{}
+	add := func(token string, entry apiToken) {
+		if _, ok := tokens[token]; ok {
+			panic(fmt.Sprintf("Invalid API_TOKENS: token for %q is already configured", entry.Alias))
+		}
+		tokens[token] = entry
+	}
+
+	if token := os.Getenv("API_TOKEN"); token != "" {
+		add(token, apiToken{Alias: "API_TOKEN", Role: roleRead})
+	}
+	if token := os.Getenv("ADMIN_API_TOKEN"); token != "" {
+		add(token, apiToken{Alias: "ADMIN_API_TOKEN", Role: roleAdmin})
+	}
+	if value := os.Getenv("API_TOKENS"); value != "" {
+		for _, triple := range strings.Split(value, ",") {
+			parts := strings.Split(strings.TrimSpace(triple), ":")
+			if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+				panic(fmt.Sprintf("Invalid API_TOKENS: entries must be alias:token:role, got %d fields", len(parts)))
+			}
+			if parts[2] != roleRead && parts[2] != roleAdmin {
+				panic(fmt.Sprintf("Invalid API_TOKENS: %q has unknown role %q", parts[0], parts[2]))
+			}
+			add(parts[1], apiToken{Alias: parts[0], Role: parts[2]})
+		}
+	}
+
+	apiTokens = tokens
+	fmt.Printf("API tokens configured: %d\n", len(apiTokens))
+}
+
+// lookupToken returns the configured entry for token.
+func lookupToken(token string) (apiToken, bool) {
+	entry, ok := apiTokens[token]
+	return entry, ok
+}
+
+// roleAllows reports whether a token with role have may use a route that
+// requires role want. Admin tokens can do everything a read token can.
+func roleAllows(have, want string) bool {
+	return have == want || have == roleAdmin
+}
+
+// requestToken returns the token the auth middleware accepted for c.
+func requestToken(c *gin.Context) (apiToken, bool) {
+	value, ok := c.Get(authTokenKey)
+	if !ok {
+		return apiToken{}, false
+	}
+	entry, ok := value.(apiToken)
+	return entry, ok
+}
+
+// requireRole rejects requests whose token lacks role. It runs after the
+// auth middleware, so the token is already known to be valid and a
+// mismatch is a 403 rather than a 401.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entry, ok := requestToken(c)
+		if !ok || !roleAllows(entry.Role, role) {
+			recordAuthDenied(deniedInsufficientRole, entry.Alias)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": fmt.Sprintf("This endpoint requires a %s token", role),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// getPing serves GET /ping, which lets integrators check their token: it
+// answers with the alias and role the token maps to, never the token itself.
+func getPing(c *gin.Context) {
+	entry, _ := requestToken(c)
+	c.JSON(http.StatusOK, gin.H{
+		"alias":       entry.Alias,
+		"role":        entry.Role,
+		"server_time": time.Now().UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	arrowContentType   = "application/vnd.apache.arrow.stream"
+	parquetContentType = "application/vnd.apache.parquet"
+)
+
+// acceptedFormat maps an Accept header asking for Arrow or Parquet to the
+// matching ?format= value. Anything else returns "" and gets the default
+// JSON response.
+func acceptedFormat(c *gin.Context) string {
+	accept := c.GetHeader("Accept")
+	switch {
+	case strings.Contains(accept, arrowContentType):
+		return "arrow"
+	case strings.Contains(accept, parquetContentType):
+		return "parquet"
+	}
+	return ""
+}
+
+// arrowSchema maps the BigQuery schema to Arrow. Scalar numeric and boolean
+// columns keep their type; everything else, including dates (already
+// formatted by convertValue), records and repeated fields, becomes a string.
+func arrowSchema(schema bigquery.Schema) *arrow.Schema {
+	fields := make([]arrow.Field, len(schema))
+	for i, field := range schema {
+		fields[i] = arrow.Field{Name: field.Name, Type: arrowType(field), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func arrowType(field *bigquery.FieldSchema) arrow.DataType {
+	if field.Repeated || field.Schema != nil {
+		return arrow.BinaryTypes.String
+	}
+	switch field.Type {
+	case bigquery.IntegerFieldType:
+		return arrow.PrimitiveTypes.Int64
+	case bigquery.FloatFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		return arrow.PrimitiveTypes.Float64
+	case bigquery.BooleanFieldType:
+		return arrow.FixedWidthTypes.Boolean
+	}
+	return arrow.BinaryTypes.String
+}
+
+// arrowRecord builds a single record batch from rows. The caller releases it.
+func arrowRecord(schema bigquery.Schema, rows []map[string]interface{}) arrow.Record {
+	builder := array.NewRecordBuilder(memory.NewGoAllocator(), arrowSchema(schema))
+	defer builder.Release()
+
+	for _, row := range rows {
+		for i, field := range schema {
+			appendArrowValue(builder.Field(i), row[field.Name])
+		}
+	}
+	return builder.NewRecord()
+}
+
+func appendArrowValue(b array.Builder, value interface{}) {
+	if value == nil {
+		b.AppendNull()
+		return
+	}
+
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		switch v := value.(type) {
+		case int64:
+			b.Append(v)
+		case float64:
+			b.Append(int64(v))
+		default:
+			b.AppendNull()
+		}
+	case *array.Float64Builder:
+		switch v := value.(type) {
+		case float64:
+			b.Append(v)
+		case int64:
+			b.Append(float64(v))
+		case *big.Rat:
+			f, _ := v.Float64()
+			b.Append(f)
+		default:
+			b.AppendNull()
+		}
+	case *array.BooleanBuilder:
+		if v, ok := value.(bool); ok {
+			b.Append(v)
+		} else {
+			b.AppendNull()
+		}
+	case *array.StringBuilder:
+		b.Append(arrowString(value))
+	default:
+		b.AppendNull()
+	}
+}
+
+func arrowString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]interface{}, map[string]bigquery.Value, []interface{}, []bigquery.Value, map[string]int64:
+		encoded, err := json.Marshal(v)
+		if err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+// respondArrow writes rows as an Arrow IPC stream, readable with
+// pyarrow.ipc.open_stream.
+func respondArrow(c *gin.Context, status int, schema bigquery.Schema, rows []map[string]interface{}) {
+	record := arrowRecord(schema, rows)
+	defer record.Release()
+
+	c.Header("Content-Type", arrowContentType)
+	c.Status(status)
+	writer := ipc.NewWriter(c.Writer, ipc.WithSchema(record.Schema()))
+	if err := writer.Write(record); err != nil {
+		loggerFrom(c.Request.Context()).Error("Arrow write error", "error", err)
+	}
+	if err := writer.Close(); err != nil {
+		loggerFrom(c.Request.Context()).Error("Arrow write error", "error", err)
+	}
+}
+
+// respondParquet writes rows as a Snappy-compressed Parquet file.
+func respondParquet(c *gin.Context, status int, schema bigquery.Schema, rows []map[string]interface{}) {
+	record := arrowRecord(schema, rows)
+	defer record.Release()
+
+	c.Header("Content-Type", parquetContentType)
+	c.Status(status)
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	writer, err := pqarrow.NewFileWriter(record.Schema(), c.Writer, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		loggerFrom(c.Request.Context()).Error("Parquet write error", "error", err)
+		return
+	}
+	if err := writer.Write(record); err != nil {
+		loggerFrom(c.Request.Context()).Error("Parquet write error", "error", err)
+	}
+	if err := writer.Close(); err != nil {
+		loggerFrom(c.Request.Context()).Error("Parquet write error", "error", err)
+	}
+}
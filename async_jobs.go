@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	asyncJobsPath = "/jobs"
+
+	// maxAsyncJobs caps the jobs held in memory, finished or not.
+	maxAsyncJobs = 1000
+
+	defaultAsyncJobTimeout = 10 * time.Minute
+	defaultAsyncJobTTL     = time.Hour
+)
+
+// asyncJob is a GET request running in the background for POST /jobs.
+type asyncJob struct {
+	ID       string       `json:"id"`
+	Status   string       `json:"status"`
+	Path     string       `json:"path"`
+	Created  time.Time    `json:"created"`
+	Finished *time.Time   `json:"finished,omitempty"`
+	Result   *batchResult `json:"result,omitempty"`
+
+	// owner is the alias of the token that started the job; only it may
+	// read the result
+	owner string
+}
+
+var asyncJobs = struct {
+	sync.Mutex
+	jobs map[string]*asyncJob
+}{jobs: map[string]*asyncJob{}}
+
+// pruneAsyncJobs drops finished jobs older than ASYNC_JOB_TTL. The caller
+// holds the lock.
+func pruneAsyncJobs(now time.Time) {
+	ttl := envDuration("ASYNC_JOB_TTL", defaultAsyncJobTTL)
+	for id, job := range asyncJobs.jobs {
+		if job.Finished != nil && now.Sub(*job.Finished) > ttl {
+			delete(asyncJobs.jobs, id)
+		}
+	}
+}
+
+// asyncJobHandler serves POST /jobs. The body names a GET request like a
+// /batch entry, e.g. {"path": "/sku-metrics/ABC123/stockout-risk"}. It is
+// answered with 202 and a job id right away, then dispatched through the
+// router in the background with the caller's credentials, so heavy
+// computations don't hold the connection open. GET /jobs/:id polls for the
+// result. Jobs run for at most ASYNC_JOB_TIMEOUT seconds (default 600) and
+// are kept for ASYNC_JOB_TTL seconds (default 3600) after finishing.
+func asyncJobHandler(router *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request batchRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid job request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if strings.HasPrefix(request.Path, asyncJobsPath) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid job request body",
+				"details": "jobs can't start other jobs",
+			})
+			return
+		}
+
+		entry, _ := requestToken(c)
+		now := time.Now()
+		job := &asyncJob{
+			ID:      newRequestID(),
+			Status:  "running",
+			Path:    request.Path,
+			Created: now,
+			owner:   entry.Alias,
+		}
+
+		asyncJobs.Lock()
+		pruneAsyncJobs(now)
+		if len(asyncJobs.jobs) >= maxAsyncJobs {
+			asyncJobs.Unlock()
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Too many jobs",
+				"details": "retry once running jobs have finished",
+			})
+			return
+		}
+		asyncJobs.jobs[job.ID] = job
+		asyncJobs.Unlock()
+
+		caller := batchCaller{
+			authorization: c.GetHeader("Authorization"),
+			apiKey:        c.GetHeader(apiKeyHeader),
+			requestID:     c.Writer.Header().Get(requestIDHeader),
+			remoteAddr:    c.Request.RemoteAddr,
+		}
+		logger := loggerFrom(c.Request.Context())
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), envDuration("ASYNC_JOB_TIMEOUT", defaultAsyncJobTimeout))
+			defer cancel()
+			result := dispatchBatchRequest(ctx, router, caller, request)
+
+			finished := time.Now()
+			asyncJobs.Lock()
+			job.Status = "done"
+			job.Finished = &finished
+			job.Result = &result
+			asyncJobs.Unlock()
+			logger.Info("Async job finished", "job_id", job.ID, "path", job.Path, "status", result.Status, "duration_ms", finished.Sub(job.Created).Milliseconds())
+		}()
+
+		logger.Info("Async job started", "job_id", job.ID, "path", job.Path)
+		statusURL := asyncJobsPath + "/" + job.ID
+		c.Header("Location", statusURL)
+		c.JSON(http.StatusAccepted, gin.H{
+			"id":         job.ID,
+			"status":     job.Status,
+			"status_url": statusURL,
+		})
+	}
+}
+
+// getAsyncJob serves GET /jobs/:id: the job's status and, once done, the
+// status and body the request produced. Jobs started with another token are
+// reported as not found.
+func getAsyncJob(c *gin.Context) {
+	entry, _ := requestToken(c)
+
+	asyncJobs.Lock()
+	pruneAsyncJobs(time.Now())
+	job, ok := asyncJobs.jobs[c.Param("id")]
+	var snapshot asyncJob
+	if ok {
+		snapshot = *job
+	}
+	asyncJobs.Unlock()
+
+	if !ok || snapshot.owner != entry.Alias {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Job not found",
+			"id":    c.Param("id"),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
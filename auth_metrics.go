@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Reasons a request is denied, the reason label of api_auth_denied_total.
+const (
+	deniedMissingToken     = "missing_token"
+	deniedInvalidToken     = "invalid_token"
+	deniedInsufficientRole = "insufficient_role"
+)
+
+type authDenial struct {
+	reason string
+	alias  string
+}
+
+// authDenials counts denied requests by reason and token alias. The alias is
+// empty when the token is missing or unknown, since an unknown token has no
+// alias and must not end up in a label itself.
+var authDenials = struct {
+	sync.Mutex
+	counts map[authDenial]int64
+}{counts: map[authDenial]int64{}}
+
+func recordAuthDenied(reason, alias string) {
+	authDenials.Lock()
+	defer authDenials.Unlock()
+	authDenials.counts[authDenial{reason, alias}]++
+}
+
+func writeAuthMetrics(b *strings.Builder) {
+	authDenials.Lock()
+	denials := make([]authDenial, 0, len(authDenials.counts))
+	counts := make(map[authDenial]int64, len(authDenials.counts))
+	for denial, count := range authDenials.counts {
+		denials = append(denials, denial)
+		counts[denial] = count
+	}
+	authDenials.Unlock()
+
+	sort.Slice(denials, func(i, j int) bool {
+		if denials[i].reason != denials[j].reason {
+			return denials[i].reason < denials[j].reason
+		}
+		return denials[i].alias < denials[j].alias
+	})
+
+	writeMetricHeader(b, "api_auth_denied_total", "counter", "Requests denied by the auth layer, by reason and token alias.")
+	for _, denial := range denials {
+		fmt.Fprintf(b, "api_auth_denied_total{reason=%q,alias=%q} %d\n", denial.reason, denial.alias, counts[denial])
+	}
+}
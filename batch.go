@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxBatchRequests  = 10
+	batchConcurrency  = 4
+	batchEndpointPath = "/batch"
+
+	defaultBatchTimeout = 30 * time.Second
+)
+
+type batchRequest struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Params map[string]string `json:"params"`
+}
+
+type batchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// batchUnfinished identifies a sub-request that missed the batch deadline.
+type batchUnfinished struct {
+	Index int    `json:"index"`
+	Path  string `json:"path"`
+}
+
+// batchCaller is what sub-requests copy from the outer request. It is taken
+// up front because sub-requests may outlive the handler after a timeout.
+type batchCaller struct {
+	authorization string
+	apiKey        string
+	requestID     string
+	remoteAddr    string
+}
+
+// batchHandler serves POST /batch. Each sub-request is dispatched through the
+// router itself so it goes through the same auth and maintenance checks as a
+// standalone call, using the credentials of the outer request.
+//
+// The batch has a deadline of BATCH_TIMEOUT seconds (default 30), bounded by
+// the request context. If it passes, the response is an object with
+// partial: true, the finished results (null for the rest) and the
+// sub-requests that didn't finish, instead of the usual array.
+func batchHandler(router *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requests []batchRequest
+		if err := c.ShouldBindJSON(&requests); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid batch request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		if len(requests) == 0 || len(requests) > maxBatchRequests {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid batch size",
+				"details": fmt.Sprintf("a batch must contain between 1 and %d requests", maxBatchRequests),
+			})
+			return
+		}
+
+		loggerFrom(c.Request.Context()).Info("Batch received", "requests", len(requests))
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), envDuration("BATCH_TIMEOUT", defaultBatchTimeout))
+		defer cancel()
+		caller := batchCaller{
+			authorization: c.GetHeader("Authorization"),
+			apiKey:        c.GetHeader(apiKeyHeader),
+			requestID:     c.Writer.Header().Get(requestIDHeader),
+			remoteAddr:    c.Request.RemoteAddr,
+		}
+
+		results := make([]*batchResult, len(requests))
+		var mu sync.Mutex
+		slots := make(chan struct{}, batchConcurrency)
+		var wg sync.WaitGroup
+
+		for i, request := range requests {
+			wg.Add(1)
+			go func(i int, request batchRequest) {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-slots }()
+
+				result := dispatchBatchRequest(ctx, router, caller, request)
+				mu.Lock()
+				defer mu.Unlock()
+				if ctx.Err() == nil {
+					results[i] = &result
+				}
+			}(i, request)
+		}
+
+		finished := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(finished)
+		}()
+
+		select {
+		case <-finished:
+			c.JSON(http.StatusOK, results)
+		case <-ctx.Done():
+			if c.Request.Context().Err() != nil {
+				// The client is gone, nobody to answer
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			unfinished := []batchUnfinished{}
+			for i, result := range results {
+				if result == nil {
+					unfinished = append(unfinished, batchUnfinished{Index: i, Path: requests[i].Path})
+				}
+			}
+			loggerFrom(c.Request.Context()).Warn("Batch deadline passed", "unfinished", len(unfinished))
+			c.JSON(http.StatusOK, gin.H{
+				"partial":    true,
+				"results":    results,
+				"unfinished": unfinished,
+			})
+		}
+	}
+}
+
+func dispatchBatchRequest(ctx context.Context, router *gin.Engine, caller batchCaller, request batchRequest) batchResult {
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet {
+		return batchResult{Status: http.StatusBadRequest, Error: "only GET requests can be batched"}
+	}
+	if !strings.HasPrefix(request.Path, "/") || strings.HasPrefix(request.Path, batchEndpointPath) {
+		return batchResult{Status: http.StatusBadRequest, Error: fmt.Sprintf("invalid path: %q", request.Path)}
+	}
+
+	query := url.Values{}
+	for key, value := range request.Params {
+		query.Set(key, value)
+	}
+	target := request.Path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return batchResult{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	req.Header.Set("Authorization", caller.authorization)
+	req.Header.Set(apiKeyHeader, caller.apiKey)
+	// Sub-requests log under the batch's request ID
+	req.Header.Set(requestIDHeader, caller.requestID)
+	req.RemoteAddr = caller.remoteAddr
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		return batchResult{Status: recorder.Code, Error: string(body)}
+	}
+	return batchResult{Status: recorder.Code, Body: body}
+}
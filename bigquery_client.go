@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultReconnectAfterFailures = 3
+	// oldClientGracePeriod lets queries still running on a replaced client
+	// finish before it is closed.
+	oldClientGracePeriod = 2 * time.Minute
+)
+
+// bigQueryClient guards the shared BigQuery client and recreates it after
+// repeated auth or connection failures, so transient credential problems heal
+// without restarting the process.
+type bigQueryClient struct {
+	mu                  sync.RWMutex
+	client              *bigquery.Client
+	connect             func(context.Context) (*bigquery.Client, error)
+	reconnectAfter      int
+	consecutiveFailures int
+	reconnects          int64
+	lastReconnect       time.Time
+	lastReconnectError  string
+}
+
+type bigQueryClientStatus struct {
+	Reconnects          int64      `json:"reconnects"`
+	LastReconnect       *time.Time `json:"last_reconnect,omitempty"`
+	LastReconnectError  string     `json:"last_reconnect_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// newBigQueryClient connects once up front; connect is kept for reconnects.
+// RECONNECT_AFTER_FAILURES sets how many consecutive auth/connection errors
+// trigger a reconnect.
+func newBigQueryClient(ctx context.Context, connect func(context.Context) (*bigquery.Client, error)) (*bigQueryClient, error) {
+	client, err := connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reconnectAfter := defaultReconnectAfterFailures
+	if value := os.Getenv("RECONNECT_AFTER_FAILURES"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			reconnectAfter = parsed
+		}
+	}
+
+	return &bigQueryClient{
+		client:         client,
+		connect:        connect,
+		reconnectAfter: reconnectAfter,
+	}, nil
+}
+
+func (b *bigQueryClient) get() *bigquery.Client {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.client
+}
+
+func (b *bigQueryClient) Query(sql string) *bigquery.Query {
+	return b.get().Query(sql)
+}
+
+func (b *bigQueryClient) Close() error {
+	return b.get().Close()
+}
+
+// isConnectionError reports whether err suggests the client itself is broken
+// (expired credentials, failed token refresh, network trouble) rather than a
+// problem with the query.
+func isConnectionError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusUnauthorized
+	}
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// reportResult records the outcome of a BigQuery call and reconnects once
+// enough consecutive connection errors have been seen.
+func (b *bigQueryClient) reportResult(err error) {
+	b.mu.Lock()
+	if err == nil || !isConnectionError(err) {
+		b.consecutiveFailures = 0
+		b.mu.Unlock()
+		return
+	}
+	b.consecutiveFailures++
+	if b.consecutiveFailures < b.reconnectAfter {
+		b.mu.Unlock()
+		return
+	}
+	b.consecutiveFailures = 0
+	b.mu.Unlock()
+
+	b.reconnect()
+}
+
+func (b *bigQueryClient) reconnect() {
+	fmt.Println("BigQuery: repeated connection errors, recreating client")
+	client, err := b.connect(context.Background())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastReconnect = time.Now()
+	if err != nil {
+		fmt.Printf("BigQuery: reconnect failed: %v\n", err)
+		b.lastReconnectError = err.Error()
+		return
+	}
+
+	old := b.client
+	b.client = client
+	b.reconnects++
+	b.lastReconnectError = ""
+	time.AfterFunc(oldClientGracePeriod, func() {
+		old.Close()
+	})
+	fmt.Println("BigQuery: client recreated")
+}
+
+func (b *bigQueryClient) status() bigQueryClientStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	status := bigQueryClientStatus{
+		Reconnects:          b.reconnects,
+		LastReconnectError:  b.lastReconnectError,
+		ConsecutiveFailures: b.consecutiveFailures,
+	}
+	if !b.lastReconnect.IsZero() {
+		lastReconnect := b.lastReconnect
+		status.LastReconnect = &lastReconnect
+	}
+	return status
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"golang.org/x/net/http2"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Transport defaults match what the Google API client uses on its own. All
+// BigQuery traffic goes to a single host, so the per-host limit is the one
+// that matters under burst load.
+const (
+	defaultBigQueryMaxIdleConns        = 100
+	defaultBigQueryMaxIdleConnsPerHost = 100
+	defaultBigQueryIdleConnTimeout     = 90 * time.Second
+)
+
+// newBigQueryHTTPClient builds the authenticated HTTP client for the BigQuery
+// API with a connection pool tuned via BIGQUERY_MAX_IDLE_CONNS,
+// BIGQUERY_MAX_IDLE_CONNS_PER_HOST and BIGQUERY_IDLE_CONN_TIMEOUT (seconds).
+// Keeping connections idle longer saves a TLS handshake per query when many
+// run in quick succession.
+func newBigQueryHTTPClient(ctx context.Context, opts ...option.ClientOption) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.MaxIdleConns = envInt("BIGQUERY_MAX_IDLE_CONNS", defaultBigQueryMaxIdleConns)
+	base.MaxIdleConnsPerHost = envInt("BIGQUERY_MAX_IDLE_CONNS_PER_HOST", defaultBigQueryMaxIdleConnsPerHost)
+	base.IdleConnTimeout = envDuration("BIGQUERY_IDLE_CONN_TIMEOUT", defaultBigQueryIdleConnTimeout)
+
+	// Like the default Google transport, ping idle HTTP/2 connections so
+	// broken ones are dropped instead of reused
+	if h2, err := http2.ConfigureTransports(base); err == nil {
+		h2.ReadIdleTimeout = 31 * time.Second
+	}
+
+	opts = append(opts, option.WithScopes(bigquery.Scope))
+	transport, err := htransport.NewTransport(ctx, base, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("BigQuery transport: max_idle=%d max_idle_per_host=%d idle_timeout=%s\n",
+		base.MaxIdleConns, base.MaxIdleConnsPerHost, base.IdleConnTimeout)
+	return &http.Client{Transport: transport}, nil
+}
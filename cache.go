@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	stored  time.Time
+	expires time.Time
+}
+
+// resultCache holds query results for a short TTL and collapses concurrent
+// misses for the same key into a single BigQuery job, so a burst of requests
+// after an expiry doesn't launch one full scan per request.
+type resultCache struct {
+	name    string
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	group   singleflight.Group
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// caches lists every resultCache so /metrics can report on them.
+var caches []*resultCache
+
+func newResultCache(name string) *resultCache {
+	rc := &resultCache{
+		name:    name,
+		entries: make(map[string]cacheEntry),
+	}
+	caches = append(caches, rc)
+	return rc
+}
+
+func (rc *resultCache) get(key string) (interface{}, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok {
+		rc.misses.Add(1)
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(rc.entries, key)
+		rc.evictions.Add(1)
+		rc.misses.Add(1)
+		return nil, false
+	}
+	rc.hits.Add(1)
+	return entry.value, true
+}
+
+func (rc *resultCache) size() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.entries)
+}
+
+// defaultCacheMaxEntries bounds each cache. Keys of the per-SKU caches come
+// from the client, so without a bound a scan over made-up SKUs would grow
+// them until the process runs out of memory.
+const defaultCacheMaxEntries = 10000
+
+// cacheMaxEntries is CACHE_MAX_ENTRIES, the most entries one cache holds.
+func cacheMaxEntries() int {
+	return envInt("CACHE_MAX_ENTRIES", defaultCacheMaxEntries)
+}
+
+func (rc *resultCache) set(key string, value interface{}, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	if _, ok := rc.entries[key]; !ok && len(rc.entries) >= cacheMaxEntries() {
+		rc.makeRoom(now)
+	}
+	rc.entries[key] = cacheEntry{value: value, stored: now, expires: now.Add(ttl)}
+}
+
+// makeRoom frees a slot for a new entry: it sweeps every expired entry and,
+// if none had expired, drops the one closest to expiring. rc.mu must be held.
+func (rc *resultCache) makeRoom(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	swept := false
+	for key, entry := range rc.entries {
+		if now.After(entry.expires) {
+			delete(rc.entries, key)
+			rc.evictions.Add(1)
+			swept = true
+			continue
+		}
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if !swept && oldestKey != "" {
+		delete(rc.entries, oldestKey)
+		rc.evictions.Add(1)
+	}
+}
+
+// storedAt returns when the live entry for key was stored, so values derived
+// from it can tell whether they are still current.
+func (rc *resultCache) storedAt(key string) (time.Time, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return time.Time{}, false
+	}
+	return entry.stored, true
+}
+
+// invalidateBefore drops key if it was stored before t, e.g. before the
+// source table was last modified.
+func (rc *resultCache) invalidateBefore(key string, t time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if entry, ok := rc.entries[key]; ok && entry.stored.Before(t) {
+		delete(rc.entries, key)
+		rc.evictions.Add(1)
+	}
+}
+
+// uncached wraps a value load returns to fetch's callers without storing it.
+type uncached struct {
+	value interface{}
+}
+
+// fetch returns the cached value for key, or runs load to produce it. Callers
+// that miss at the same time share one load call; a caller whose ctx ends
+// stops waiting without cancelling the shared load. The returned bool
+// reports whether the value came from the cache. The cacheMode in ctx can
+// skip the lookup, and with cacheSkip the result isn't stored either; load
+// can also keep a result out of the cache by wrapping it in uncached.
+func (rc *resultCache) fetch(ctx context.Context, key string, ttl time.Duration, load func() (interface{}, error)) (interface{}, bool, error) {
+	switch cacheModeFrom(ctx) {
+	case cacheSkip:
+		rc.misses.Add(1)
+		value, err := load()
+		if u, ok := value.(uncached); ok {
+			value = u.value
+		}
+		return value, false, err
+	case cacheRefresh:
+		rc.misses.Add(1)
+	default:
+		if value, ok := rc.get(key); ok {
+			return value, true, nil
+		}
+	}
+
+	ch := rc.group.DoChan(key, func() (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := value.(uncached); ok {
+			return u.value, nil
+		}
+		rc.set(key, value, ttl)
+		return value, nil
+	})
+
+	select {
+	case result := <-ch:
+		if result.Shared {
+			loggerFrom(ctx).Info("Cache shared in-flight query", "cache", rc.name, "key", key)
+		}
+		return result.Val, false, result.Err
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// cacheTTL reads a TTL in seconds from the given env var, falling back to def.
+func cacheTTL(envVar string, def time.Duration) time.Duration {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return def
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		fmt.Printf("WARNING: Ignoring invalid %s: %s\n", envVar, value)
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Cache policy: results of unfiltered full-table reads only change when dbt
+// rebuilds the table, about daily, so they are kept much longer than the
+// results of filtered or parameterized queries, where a stale answer for
+// one SKU is more visible. Set CACHE_TTL_UNFILTERED and CACHE_TTL_FILTERED
+// (seconds, 0 disables caching) to change the policy; the per-endpoint TTL
+// variables still take precedence.
+const (
+	defaultUnfilteredCacheTTL = time.Hour
+	defaultFilteredCacheTTL   = 5 * time.Minute
+)
+
+func unfilteredCacheTTL(envVar string) time.Duration {
+	return cacheTTL(envVar, cacheTTL("CACHE_TTL_UNFILTERED", defaultUnfilteredCacheTTL))
+}
+
+func filteredCacheTTL(envVar string) time.Duration {
+	return cacheTTL(envVar, cacheTTL("CACHE_TTL_FILTERED", defaultFilteredCacheTTL))
+}
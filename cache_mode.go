@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cacheMode controls how resultCache.fetch treats the cache for a request.
+//
+//   - ?nocache=true skips the cache for this one read: the query always runs
+//     and its result is not stored, so other clients keep seeing the cached
+//     value. Use it to check what BigQuery returns right now.
+//   - ?refresh=true also always runs the query, but stores the result, so
+//     everyone after benefits. Use it to prime the cache right after a known
+//     data update.
+type cacheMode int
+
+const (
+	cacheNormal cacheMode = iota
+	cacheSkip
+	cacheRefresh
+)
+
+type cacheModeContextKey struct{}
+
+func cacheModeFrom(ctx context.Context) cacheMode {
+	mode, _ := ctx.Value(cacheModeContextKey{}).(cacheMode)
+	return mode
+}
+
+// cacheModeMiddleware reads ?nocache= and ?refresh= into the request context,
+// where resultCache.fetch picks it up.
+func cacheModeMiddleware(c *gin.Context) {
+	mode := cacheNormal
+	if c.Query("refresh") == "true" {
+		mode = cacheRefresh
+	} else if c.Query("nocache") == "true" {
+		mode = cacheSkip
+	}
+	if mode != cacheNormal {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), cacheModeContextKey{}, mode))
+	}
+	c.Next()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+const defaultPersistCacheMaxAge = 10 * time.Minute
+
+func init() {
+	// Concrete types that can sit behind interface{} in a rowSet
+	gob.Register(rowSet{})
+	gob.Register(time.Time{})
+	gob.Register(civil.Date{})
+	gob.Register(civil.Time{})
+	gob.Register(civil.DateTime{})
+	gob.Register(new(big.Rat))
+	gob.Register([]bigquery.Value{})
+	gob.Register(map[string]bigquery.Value{})
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// persistedCaches is the on-disk form of the result caches. SavedAt lets a
+// reader reject a file that is too old to trust, and DateLayout one whose
+// dates were formatted differently.
+type persistedCaches struct {
+	SavedAt    time.Time
+	DateLayout string
+	Caches     map[string]map[string]persistedEntry
+}
+
+type persistedEntry struct {
+	Value   rowSet
+	Stored  time.Time
+	Expires time.Time
+}
+
+func persistCacheEnabled() bool {
+	return os.Getenv("PERSIST_CACHE") == "true"
+}
+
+// persistCachePath is PERSIST_CACHE_PATH, or a file in the temp dir. On Cloud
+// Run it should point at a mounted volume to survive a new instance.
+func persistCachePath() string {
+	if path := os.Getenv("PERSIST_CACHE_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(os.TempDir(), "golangapi-cache.gob")
+}
+
+// saveCaches writes the unexpired query results of every cache to disk. Only
+// rowSet values are persisted; other caches are cheap to rebuild.
+func saveCaches(path string) error {
+	snapshot := persistedCaches{
+		SavedAt:    time.Now(),
+		DateLayout: dateLayout,
+		Caches:     make(map[string]map[string]persistedEntry),
+	}
+
+	count := 0
+	for _, rc := range caches {
+		rc.mu.Lock()
+		for key, entry := range rc.entries {
+			value, ok := entry.value.(rowSet)
+			if !ok || snapshot.SavedAt.After(entry.expires) {
+				continue
+			}
+			if snapshot.Caches[rc.name] == nil {
+				snapshot.Caches[rc.name] = make(map[string]persistedEntry)
+			}
+			snapshot.Caches[rc.name][key] = persistedEntry{Value: value, Stored: entry.stored, Expires: entry.expires}
+			count++
+		}
+		rc.mu.Unlock()
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated cache
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(file).Encode(snapshot); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Persisted %d cache entries to %s\n", count, path)
+	return nil
+}
+
+// loadCaches restores entries saved by saveCaches. The whole file is ignored
+// if it is older than PERSIST_CACHE_MAX_AGE (seconds, default 10 minutes),
+// and entries keep their original expiry so the cache TTLs still hold.
+func loadCaches(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("No persisted cache found at %s\n", path)
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	var snapshot persistedCaches
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	age := time.Since(snapshot.SavedAt)
+	maxAge := cacheTTL("PERSIST_CACHE_MAX_AGE", defaultPersistCacheMaxAge)
+	if age < 0 || age > maxAge {
+		fmt.Printf("Ignoring persisted cache at %s: saved %s ago, max age is %s\n", path, age.Round(time.Second), maxAge)
+		return nil
+	}
+	if snapshot.DateLayout != dateLayout {
+		fmt.Printf("Ignoring persisted cache at %s: saved with DATE_LAYOUT %q\n", path, snapshot.DateLayout)
+		return nil
+	}
+
+	now := time.Now()
+	count := 0
+	for _, rc := range caches {
+		rc.mu.Lock()
+		for key, entry := range snapshot.Caches[rc.name] {
+			if now.After(entry.Expires) {
+				continue
+			}
+			rc.entries[key] = cacheEntry{value: entry.Value, stored: entry.Stored, expires: entry.Expires}
+			count++
+		}
+		rc.mu.Unlock()
+	}
+
+	fmt.Printf("Restored %d cache entries from %s (saved %s ago)\n", count, path, age.Round(time.Second))
+	return nil
+}
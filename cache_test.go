@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestResultCacheFetchLoadsOnce fires concurrent fetches of one key and
+// checks the loader ran once: callers either share the in-flight load or,
+// arriving after it finished, hit the stored value.
+func TestResultCacheFetchLoadsOnce(t *testing.T) {
+	rc := &resultCache{name: "test", entries: make(map[string]cacheEntry)}
+	const callers = 50
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func() (interface{}, error) {
+		loads.Add(1)
+		<-release
+		return "rows", nil
+	}
+
+	var wg sync.WaitGroup
+	values := make([]interface{}, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], _, errs[i] = rc.fetch(context.Background(), "all", time.Minute, load)
+		}()
+	}
+	// let the callers pile up on the in-flight load before it returns
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loader ran %d times, want 1", n)
+	}
+	for i := range values {
+		if errs[i] != nil || values[i] != "rows" {
+			t.Errorf("caller %d got %v, %v", i, values[i], errs[i])
+		}
+	}
+
+	if _, hit, _ := rc.fetch(context.Background(), "all", time.Minute, load); !hit {
+		t.Error("fetch after the load should be a cache hit")
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loader ran %d times after a cache hit, want 1", n)
+	}
+}
+
+// TestResultCacheMaxEntries fills a cache past CACHE_MAX_ENTRIES and checks
+// it sweeps expired entries first, then drops the one closest to expiring.
+func TestResultCacheMaxEntries(t *testing.T) {
+	t.Setenv("CACHE_MAX_ENTRIES", "2")
+	rc := &resultCache{name: "test", entries: make(map[string]cacheEntry)}
+
+	rc.set("a", 1, time.Minute)
+	rc.set("b", 2, time.Hour)
+	rc.set("c", 3, time.Hour)
+	if _, ok := rc.get("a"); ok {
+		t.Error("a should have been evicted as the entry closest to expiring")
+	}
+	if n := rc.size(); n != 2 {
+		t.Errorf("size = %d, want 2", n)
+	}
+
+	rc.mu.Lock()
+	for key, entry := range rc.entries {
+		entry.expires = time.Now().Add(-time.Second)
+		rc.entries[key] = entry
+	}
+	rc.mu.Unlock()
+	rc.set("d", 4, time.Hour)
+	if n := rc.size(); n != 1 {
+		t.Errorf("size after sweeping expired entries = %d, want 1", n)
+	}
+	if _, ok := rc.get("d"); !ok {
+		t.Error("d should be cached")
+	}
+}
+
+// TestResultCacheFetchUncached checks that a load result wrapped in uncached
+// reaches the caller but isn't stored.
+func TestResultCacheFetchUncached(t *testing.T) {
+	rc := &resultCache{name: "test", entries: make(map[string]cacheEntry)}
+	load := func() (interface{}, error) {
+		return uncached{"empty"}, nil
+	}
+
+	value, hit, err := rc.fetch(context.Background(), "unknown", time.Minute, load)
+	if err != nil || hit || value != "empty" {
+		t.Errorf("fetch = %v, %t, %v; want empty, false, nil", value, hit, err)
+	}
+	if n := rc.size(); n != 0 {
+		t.Errorf("size = %d, want 0", n)
+	}
+}
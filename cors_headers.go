@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultExposeHeaders are the response headers browser clients may read
+// from JavaScript. Without them in Access-Control-Expose-Headers, CORS hides
+// everything but the safelisted headers.
+var defaultExposeHeaders = []string{
+	fieldsHeader,
+	requestIDHeader,
+	ndjsonMetadataHeader,
+	"X-Total-Count",
+	"X-Total-Items",
+	"X-Total-POs",
+	"X-Truncated",
+	skuExistsHeader,
+	"X-Cache",
+	"X-BigQuery-Bytes-Processed",
+	"ETag",
+	"Last-Modified",
+	"Link",
+	"Retry-After",
+}
+
+// corsExposeHeaders returns the default exposed headers plus any listed in
+// CORS_EXPOSE_HEADERS (comma-separated).
+func corsExposeHeaders() []string {
+	headers := append([]string{}, defaultExposeHeaders...)
+	for _, header := range strings.Split(os.Getenv("CORS_EXPOSE_HEADERS"), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+)
+
+// corsPolicy is the CORS configuration for one environment. Empty lists keep
+// the defaults (gin-contrib/cors's, plus Authorization and X-Api-Key in
+// allow_headers), and expose_headers adds to corsExposeHeaders rather than
+// replacing them.
+type corsPolicy struct {
+	AllowOrigins     []string `json:"allow_origins"`
+	AllowMethods     []string `json:"allow_methods"`
+	AllowHeaders     []string `json:"allow_headers"`
+	ExposeHeaders    []string `json:"expose_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAgeSeconds    int      `json:"max_age_seconds"`
+}
+
+// loadCORSConfig builds the CORS config for env at startup. The policies come
+// from CORS_POLICY (JSON) or CORS_POLICY_FILE (a path to the same JSON), an
+// object keyed by environment with an optional "default" entry:
+//
+//	{"production": {"allow_origins": ["https://app.example.com"]},
+//	 "default": {"allow_origins": ["*"]}}
+//
+// Without either variable every origin is allowed, as before. A malformed or
+// invalid policy panics so a bad deploy fails immediately.
+func loadCORSConfig(env string) cors.Config {
+	config := cors.DefaultConfig()
+	config.AllowHeaders = append(config.AllowHeaders, "Authorization", apiKeyHeader)
+	config.ExposeHeaders = corsExposeHeaders()
+
+	data, source := []byte(os.Getenv("CORS_POLICY")), "CORS_POLICY"
+	if path := os.Getenv("CORS_POLICY_FILE"); len(data) == 0 && path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to read CORS_POLICY_FILE: %v", err))
+		}
+		source = path
+	}
+	if len(data) == 0 {
+		config.AllowAllOrigins = true
+		fmt.Println("CORS: allowing all origins (no CORS_POLICY set)")
+		return config
+	}
+
+	var policies map[string]corsPolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policies); err != nil {
+		panic(fmt.Sprintf("Invalid CORS policy in %s: %v", source, err))
+	}
+	name := env
+	if name == "" {
+		name = "development"
+	}
+	policy, ok := policies[name]
+	if !ok {
+		policy, ok = policies["default"]
+	}
+	if !ok {
+		panic(fmt.Sprintf("Invalid CORS policy in %s: no entry for %q and no default", source, name))
+	}
+
+	if len(policy.AllowOrigins) == 1 && policy.AllowOrigins[0] == "*" {
+		if policy.AllowCredentials {
+			panic(fmt.Sprintf("Invalid CORS policy in %s: allow_credentials needs explicit origins, not *", source))
+		}
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOrigins = policy.AllowOrigins
+	}
+	if len(policy.AllowMethods) > 0 {
+		config.AllowMethods = policy.AllowMethods
+	}
+	if len(policy.AllowHeaders) > 0 {
+		config.AllowHeaders = policy.AllowHeaders
+	}
+	config.ExposeHeaders = append(config.ExposeHeaders, policy.ExposeHeaders...)
+	config.AllowCredentials = policy.AllowCredentials
+	if policy.MaxAgeSeconds < 0 {
+		panic(fmt.Sprintf("Invalid CORS policy in %s: max_age_seconds must not be negative", source))
+	}
+	if policy.MaxAgeSeconds > 0 {
+		config.MaxAge = time.Duration(policy.MaxAgeSeconds) * time.Second
+	}
+
+	if err := config.Validate(); err != nil {
+		panic(fmt.Sprintf("Invalid CORS policy in %s: %v", source, err))
+	}
+	if config.AllowAllOrigins {
+		fmt.Printf("CORS: %s policy allows all origins\n", name)
+	} else {
+		fmt.Printf("CORS: %s policy allows %s\n", name, strings.Join(config.AllowOrigins, ", "))
+	}
+	return config
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// TestCORSPreflightAllowsAuthHeaders checks that a browser may send either
+// credential header with the default policy.
+func TestCORSPreflightAllowsAuthHeaders(t *testing.T) {
+	t.Setenv("CORS_POLICY", "")
+	t.Setenv("CORS_POLICY_FILE", "")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(cors.New(loadCORSConfig("production")))
+	router.GET("/sku-metrics", func(c *gin.Context) {
+		c.Status(http.StatusUnauthorized)
+	})
+
+	for _, header := range []string{"Authorization", apiKeyHeader} {
+		req := httptest.NewRequest(http.MethodOptions, "/sku-metrics", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		req.Header.Set("Access-Control-Request-Headers", header)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: preflight status %d, want 204", header, w.Code)
+		}
+		allowed := strings.ToLower(w.Header().Get("Access-Control-Allow-Headers"))
+		if !strings.Contains(allowed, strings.ToLower(header)) {
+			t.Errorf("%s: Access-Control-Allow-Headers = %q", header, allowed)
+		}
+	}
+}
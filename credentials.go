@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// serviceAccountPath is the key file used when no secret is configured.
+const serviceAccountPath = "./golang-api-bigquery.json"
+
+// bigQueryCredentials picks the BigQuery credentials, in order:
+//
+//  1. BIGQUERY_CREDENTIALS_SECRET, a Secret Manager secret holding the
+//     service-account JSON, e.g. projects/p/secrets/bigquery-key (the latest
+//     version unless the name ends in /versions/N). The secret itself is read
+//     with Application Default Credentials.
+//  2. The key file at serviceAccountPath, if present.
+//  3. Application Default Credentials, e.g. the Cloud Run service account.
+//
+// The returned options are empty for ADC. A configured secret that can't be
+// read is an error rather than a silent fallback.
+func bigQueryCredentials(ctx context.Context) ([]option.ClientOption, error) {
+	if name := os.Getenv("BIGQUERY_CREDENTIALS_SECRET"); name != "" {
+		if !strings.Contains(name, "/versions/") {
+			name += "/versions/latest"
+		}
+		data, err := accessSecret(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("reading BIGQUERY_CREDENTIALS_SECRET %s: %w", name, err)
+		}
+		fmt.Printf("Using service account from Secret Manager: %s\n", name)
+		return []option.ClientOption{option.WithCredentialsJSON(data)}, nil
+	}
+
+	if _, err := os.Stat(serviceAccountPath); err == nil {
+		fmt.Printf("Using service account: %s\n", serviceAccountPath)
+		return []option.ClientOption{option.WithCredentialsFile(serviceAccountPath)}, nil
+	}
+
+	fmt.Println("Using Application Default Credentials")
+	return nil, nil
+}
+
+// accessSecret returns the payload of a secret version.
+func accessSecret(ctx context.Context, name string) ([]byte, error) {
+	service, err := secretmanager.NewService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	version, err := service.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(version.Payload.Data)
+}
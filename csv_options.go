@@ -0,0 +1,45 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// csvDelimiters are the field delimiters ?delimiter= accepts: comma, the
+// semicolon European Excel expects, pipe and tab.
+var csvDelimiters = map[string]rune{
+	",":  ',',
+	";":  ';',
+	"|":  '|',
+	"\t": '\t',
+}
+
+// csvOptions shape CSV output. The zero value is standard comma-delimited CSV
+// with '.' decimals.
+type csvOptions struct {
+	Delimiter    rune
+	DecimalComma bool
+}
+
+// parseCSVOptions reads ?delimiter= (one of csvDelimiters, default ',') and
+// ?decimal= ('.' or ','), recording problems in v. A decimal comma needs a
+// delimiter other than a comma.
+func parseCSVOptions(c *gin.Context, v *validator) csvOptions {
+	opts := csvOptions{Delimiter: ','}
+	if raw, ok := c.GetQuery("delimiter"); ok {
+		delimiter, valid := csvDelimiters[raw]
+		if !valid {
+			v.add("delimiter", "delimiter must be one of , ; | or a tab")
+		} else {
+			opts.Delimiter = delimiter
+		}
+	}
+	switch c.DefaultQuery("decimal", ".") {
+	case ".":
+	case ",":
+		opts.DecimalComma = true
+		if opts.Delimiter == ',' {
+			v.add("decimal", "decimal=, needs a delimiter other than a comma, e.g. delimiter=;")
+		}
+	default:
+		v.add("decimal", "decimal must be . or ,")
+	}
+	return opts
+}
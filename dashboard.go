@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// dashboardCache holds the KPIs for a few minutes, since the overview screen
+// requests them on every page load.
+var dashboardCache = newResultCache("dashboard")
+
+// dashboardStockQuery totals the metrics table, one row per SKU and size.
+const dashboardStockQuery = `
+		SELECT
+		  COUNT(DISTINCT sku) AS total_skus,
+		  SUM(available_count) AS units_available,
+		  SUM(sold_last_24_months) AS units_sold_last_24_months,
+		  SUM(open_orders_quantity) AS open_orders,
+		  COUNTIF(IFNULL(available_count, 0) <= 0) AS out_of_stock_sizes
+		FROM metal-force-400307.agent.sku_sizes_metrics
+	`
+
+// dashboardInboundQuery values the upcoming purchase order items like
+// /purchase-orders/value-by-month, without placeholder items.
+const dashboardInboundQuery = `
+		WITH prices AS (
+		  SELECT product_id, ANY_VALUE(purchase_price) AS purchase_price
+		  FROM metal-force-400307.agent.sku_sizes_metrics
+		  WHERE product_id IS NOT NULL
+		  GROUP BY product_id
+		)
+		SELECT
+		  ROUND(SUM(items.quantity * prices.purchase_price), 2) AS inbound_po_value,
+		  SUM(items.quantity) AS inbound_po_units
+		FROM metal-force-400307.agent.purchase_orders po,
+		UNNEST(po.items) AS items
+		LEFT JOIN prices ON prices.product_id = items.product_id
+		WHERE po.delivery_date >= FORMAT_DATE('%Y-%m-%d', CURRENT_DATE())
+		  AND items.product_id != 0
+	`
+
+// getDashboard serves GET /dashboard: the overview screen's KPIs in one
+// call. The stock totals and the inbound PO value are separate queries run
+// concurrently.
+func getDashboard(c *gin.Context) {
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Dashboard requested")
+
+	queryStart := time.Now()
+	value, hit, err := dashboardCache.fetch(ctx, "kpis", filteredCacheTTL("DASHBOARD_CACHE_TTL"), func() (interface{}, error) {
+		return queryDashboard(detachedContext(ctx))
+	})
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	c.Set(queryTimeKey, time.Since(queryStart))
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	respondJSON(c, http.StatusOK, value)
+}
+
+// queryDashboard runs the KPI queries concurrently and merges their single
+// rows.
+func queryDashboard(ctx context.Context) (map[string]interface{}, error) {
+	queries := []string{dashboardStockQuery, dashboardInboundQuery}
+	rows := make([]map[string]interface{}, len(queries))
+	errs := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, sql := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows[i], errs[i] = queryDashboardRow(ctx, sql)
+		}()
+	}
+	wg.Wait()
+
+	kpis := map[string]interface{}{
+		"computed_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	for i := range queries {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for key, value := range rows[i] {
+			kpis[key] = value
+		}
+	}
+	return kpis, nil
+}
+
+func queryDashboardRow(ctx context.Context, sql string) (map[string]interface{}, error) {
+	query, err := newQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []bigquery.Value
+	row := make(map[string]interface{})
+	if err := it.Next(&values); err == iterator.Done {
+		return row, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i, field := range it.Schema {
+		if i < len(values) {
+			row[field.Name] = convertValue(field, values[i])
+		}
+	}
+	return row, nil
+}
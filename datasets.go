@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+const bigQueryProject = "metal-force-400307"
+
+var defaultAllowedDatasets = []string{"agent", "staging"}
+
+// tableRefPattern matches fully-qualified table names, backquoted or not, and
+// captures the project and dataset, e.g. metal-force-400307 and staging in
+// metal-force-400307.staging.stg_xentral__inventory. Project IDs start with a
+// lowercase letter, which keeps decimals and column paths out.
+var tableRefPattern = regexp.MustCompile("(?:^|[^A-Za-z0-9_.`-])`?([a-z][a-z0-9-]*)`?\\.`?([A-Za-z0-9_]+)`?\\.`?[A-Za-z0-9_]")
+
+var allowedDatasets = datasetSet(defaultAllowedDatasets)
+
+func datasetSet(datasets []string) map[string]bool {
+	set := make(map[string]bool, len(datasets))
+	for _, dataset := range datasets {
+		set[dataset] = true
+	}
+	return set
+}
+
+// loadAllowedDatasets reads ALLOWED_DATASETS (comma-separated) at startup and
+// panics on a malformed list so a bad deploy fails immediately.
+func loadAllowedDatasets() {
+	value := os.Getenv("ALLOWED_DATASETS")
+	if value == "" {
+		fmt.Printf("Allowed datasets: %s\n", strings.Join(defaultAllowedDatasets, ", "))
+		return
+	}
+
+	var datasets []string
+	for _, dataset := range strings.Split(value, ",") {
+		dataset = strings.TrimSpace(dataset)
+		if dataset == "" {
+			panic(fmt.Sprintf("Invalid ALLOWED_DATASETS: %q contains an empty entry", value))
+		}
+		datasets = append(datasets, dataset)
+	}
+
+	allowedDatasets = datasetSet(datasets)
+	fmt.Printf("Allowed datasets: %s\n", strings.Join(datasets, ", "))
+}
+
+// checkQueryDatasets returns an error if sql references a table in another
+// project or in a dataset outside the allow-list. This is defence in depth
+// against a query pointing at the wrong dataset, e.g. prod instead of
+// staging.
+func checkQueryDatasets(sql string) error {
+	for _, match := range tableRefPattern.FindAllStringSubmatch(sql, -1) {
+		if project := match[1]; project != bigQueryProject {
+			return fmt.Errorf("query references project %q, only %s is allowed", project, bigQueryProject)
+		}
+		if dataset := match[2]; !allowedDatasets[dataset] {
+			return fmt.Errorf("query references dataset %q which is not in the allowed datasets", dataset)
+		}
+	}
+	return nil
+}
+
+// newQuery builds a BigQuery query after checking the datasets it touches.
+// All handlers should build their queries through it.
+func newQuery(sql string) (*bigquery.Query, error) {
+	if err := checkQueryDatasets(sql); err != nil {
+		return nil, err
+	}
+	return bqClient.Query(sql), nil
+}
+
+// tableRef returns a handle for reading a table directly, after the same
+// dataset check newQuery applies to SQL.
+func tableRef(dataset, table string) (*bigquery.Table, error) {
+	if !allowedDatasets[dataset] {
+		return nil, fmt.Errorf("table %s.%s is not in the allowed datasets", dataset, table)
+	}
+	return bqClient.get().DatasetInProject(bigQueryProject, dataset).Table(table), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestCheckQueryDatasets(t *testing.T) {
+	tests := []struct {
+		name  string
+		sql   string
+		valid bool
+	}{
+		{"allowed dataset", "SELECT * FROM metal-force-400307.staging.stg_xentral__inventory", true},
+		{"backquoted", "SELECT * FROM `metal-force-400307.agent.purchase_orders`", true},
+		{"backquoted project", "SELECT * FROM `metal-force-400307`.agent.purchase_orders", true},
+		{"unknown dataset", "SELECT * FROM metal-force-400307.prod.sku_sizes_metrics", false},
+		{"other project", "SELECT * FROM other-project.staging.stg_xentral__inventory", false},
+		{"other project backquoted", "SELECT * FROM `other-project.agent.purchase_orders`", false},
+		{"other project in join", "SELECT * FROM metal-force-400307.agent.purchase_orders po JOIN bigquery-public-data.samples.shakespeare s ON TRUE", false},
+		{"public dataset", "SELECT * FROM bigquery-public-data.samples.shakespeare", false},
+		{"column paths", "SELECT a.size, EXTRACT(YEAR FROM o.created_at), 0.5 FROM sizes a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkQueryDatasets(tt.sql)
+			if valid := err == nil; valid != tt.valid {
+				t.Errorf("checkQueryDatasets(%q) = %v, want valid %t", tt.sql, err, tt.valid)
+			}
+		})
+	}
+}
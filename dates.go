@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+// dateLayout is the layout every date field is serialized with, so clients
+// see the same format whether BigQuery returned a DATE or a date string.
+// RFC3339 by default, configurable via DATE_LAYOUT (a Go time layout).
+var dateLayout = time.RFC3339
+
+func loadDateLayout() {
+	if layout := os.Getenv("DATE_LAYOUT"); layout != "" {
+		dateLayout = layout
+	}
+	fmt.Printf("Date layout: %s\n", dateLayout)
+}
+
+// isDateFieldName reports whether a STRING column holds dates. Some source
+// tables store dates as 'YYYY-MM-DD' strings, e.g. delivery_date.
+func isDateFieldName(name string) bool {
+	return name == "date" || strings.HasSuffix(name, "_date")
+}
+
+func formatDate(date civil.Date) string {
+	return date.In(time.UTC).Format(dateLayout)
+}
+
+// convertValue prepares a BigQuery value for the response: DATE values and
+// date strings are formatted with dateLayout, recursing into records and
+// repeated fields. Everything else is returned unchanged.
+func convertValue(field *bigquery.FieldSchema, value bigquery.Value) bigquery.Value {
+	if value == nil {
+		return nil
+	}
+
+	if field.Repeated {
+		values, ok := value.([]bigquery.Value)
+		if !ok {
+			return value
+		}
+		element := *field
+		element.Repeated = false
+		converted := make([]bigquery.Value, len(values))
+		for i, v := range values {
+			converted[i] = convertValue(&element, v)
+		}
+		return converted
+	}
+
+	if field.Schema != nil {
+		switch record := value.(type) {
+		case map[string]bigquery.Value:
+			for _, subfield := range field.Schema {
+				record[subfield.Name] = convertValue(subfield, record[subfield.Name])
+			}
+		case []bigquery.Value:
+			for i, subfield := range field.Schema {
+				if i < len(record) {
+					record[i] = convertValue(subfield, record[i])
+				}
+			}
+		}
+		return value
+	}
+
+	switch v := value.(type) {
+	case civil.Date:
+		return formatDate(v)
+	case string:
+		if isDateFieldName(field.Name) {
+			if date, err := civil.ParseDate(v); err == nil {
+				return formatDate(date)
+			}
+		}
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+)
+
+func TestConvertValue(t *testing.T) {
+	date := civil.Date{Year: 2026, Month: time.October, Day: 16}
+	dateField := &bigquery.FieldSchema{Name: "inventory_as_of", Type: bigquery.DateFieldType}
+
+	tests := []struct {
+		name   string
+		layout string
+		field  *bigquery.FieldSchema
+		value  bigquery.Value
+		want   bigquery.Value
+	}{
+		{"DATE value", time.RFC3339, dateField, date, "2026-10-16T00:00:00Z"},
+		{"DATE value, custom layout", "2006-01-02", dateField, date, "2026-10-16"},
+		{"date string", time.RFC3339, &bigquery.FieldSchema{Name: "delivery_date", Type: bigquery.StringFieldType}, "2026-10-16", "2026-10-16T00:00:00Z"},
+		{"date string, custom layout", "02.01.2006", &bigquery.FieldSchema{Name: "date", Type: bigquery.StringFieldType}, "2026-10-16", "16.10.2026"},
+		{"unparseable date string", time.RFC3339, &bigquery.FieldSchema{Name: "delivery_date", Type: bigquery.StringFieldType}, "soon", "soon"},
+		{"string outside a date field", time.RFC3339, &bigquery.FieldSchema{Name: "sku", Type: bigquery.StringFieldType}, "2026-10-16", "2026-10-16"},
+		{"NULL DATE", time.RFC3339, dateField, nil, nil},
+		{"number", time.RFC3339, &bigquery.FieldSchema{Name: "quantity", Type: bigquery.IntegerFieldType}, int64(3), int64(3)},
+		{
+			"repeated DATE",
+			time.RFC3339,
+			&bigquery.FieldSchema{Name: "dates", Type: bigquery.DateFieldType, Repeated: true},
+			[]bigquery.Value{date, nil},
+			[]bigquery.Value{"2026-10-16T00:00:00Z", nil},
+		},
+		{
+			"record with a date string",
+			time.RFC3339,
+			&bigquery.FieldSchema{Name: "items", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "sku", Type: bigquery.StringFieldType},
+				{Name: "delivery_date", Type: bigquery.StringFieldType},
+			}},
+			map[string]bigquery.Value{"sku": "ABC123456M", "delivery_date": "2026-10-16"},
+			map[string]bigquery.Value{"sku": "ABC123456M", "delivery_date": "2026-10-16T00:00:00Z"},
+		},
+	}
+
+	defer func(layout string) { dateLayout = layout }(dateLayout)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dateLayout = tt.layout
+			if got := convertValue(tt.field, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertValue(%v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/googleapi"
+)
+
+// exportJobLabel marks the extract jobs started by POST /exports, so
+// GET /exports/:id can't be used to inspect arbitrary jobs in the project.
+const exportJobLabel = "api_export"
+
+// exportFormats maps ?format= on POST /exports to the extract format and file
+// extension.
+var exportFormats = map[string]struct {
+	format    bigquery.DataFormat
+	extension string
+}{
+	"csv":     {bigquery.CSV, "csv"},
+	"json":    {bigquery.JSON, "jsonl"},
+	"parquet": {bigquery.Parquet, "parquet"},
+}
+
+// postExport serves POST /exports. It starts a BigQuery extract job writing
+// sku_sizes_metrics to EXPORT_BUCKET (optionally under EXPORT_PREFIX) and
+// returns the job id right away; the dump never passes through this API.
+// ?format= picks csv (default), json or parquet, and ?delimiter= sets the
+// CSV field delimiter. BigQuery can't write decimal commas, so ?decimal=, is
+// rejected here.
+func postExport(c *gin.Context) {
+	bucket := os.Getenv("EXPORT_BUCKET")
+	if bucket == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Exports are not configured",
+			"details": "EXPORT_BUCKET is not set",
+		})
+		return
+	}
+
+	name := c.DefaultQuery("format", "csv")
+	format, ok := exportFormats[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid format parameter",
+			"details": "format must be csv, json or parquet",
+		})
+		return
+	}
+
+	// The wildcard lets BigQuery split exports larger than 1 GB into shards
+	object := fmt.Sprintf("sku_sizes_metrics-%s-*.%s", time.Now().UTC().Format("20060102T150405Z"), format.extension)
+	if prefix := strings.Trim(os.Getenv("EXPORT_PREFIX"), "/"); prefix != "" {
+		object = prefix + "/" + object
+	}
+	uri := fmt.Sprintf("gs://%s/%s", bucket, object)
+
+	var v validator
+	opts := parseCSVOptions(c, &v)
+	if opts.DecimalComma {
+		v.add("decimal", "exports only support . decimals")
+	}
+	if v.respond(c) {
+		return
+	}
+
+	dst := bigquery.NewGCSReference(uri)
+	dst.DestinationFormat = format.format
+	if format.format == bigquery.CSV {
+		dst.FieldDelimiter = string(opts.Delimiter)
+	}
+	table := bqClient.get().DatasetInProject(bigQueryProject, "agent").Table("sku_sizes_metrics")
+	extractor := table.ExtractorTo(dst)
+	extractor.Labels = map[string]string{exportJobLabel: "true"}
+
+	job, err := extractor.Run(c.Request.Context())
+	bqClient.reportResult(err)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	loggerFrom(c.Request.Context()).Info("Started export job", "job_id", job.ID(), "destination_uri", uri)
+	c.JSON(http.StatusAccepted, gin.H{
+		"id":              job.ID(),
+		"status":          "running",
+		"destination_uri": uri,
+		"status_url":      "/exports/" + job.ID(),
+	})
+}
+
+// getExport serves GET /exports/:id with the state of an export job and,
+// once it is done, the GCS URI and number of files written.
+func getExport(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	job, err := bqClient.get().JobFromID(ctx, id)
+	bqClient.reportResult(err)
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found", "id": id})
+			return
+		}
+		respondQueryError(c, err)
+		return
+	}
+
+	config, err := job.Config()
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	extract, ok := config.(*bigquery.ExtractConfig)
+	if !ok || extract.Labels[exportJobLabel] != "true" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found", "id": id})
+		return
+	}
+
+	status := job.LastStatus()
+	response := gin.H{
+		"id":               id,
+		"destination_uris": extract.Dst.URIs,
+		"format":           extract.Dst.DestinationFormat,
+	}
+	switch {
+	case !status.Done():
+		response["status"] = "running"
+	case status.Err() != nil:
+		response["status"] = "failed"
+		response["error"] = status.Err().Error()
+	default:
+		response["status"] = "done"
+		if status.Statistics != nil {
+			response["finished_at"] = status.Statistics.EndTime
+			if stats, ok := status.Statistics.Details.(*bigquery.ExtractStatistics); ok {
+				response["file_counts"] = stats.DestinationURIFileCounts
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trustedProxyNets is TRUSTED_PROXIES parsed into networks, with plain IPs
+// as single-address networks. Invalid entries are skipped here; the router
+// already refuses to start with them.
+var trustedProxyNets = sync.OnceValue(func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, proxy := range trustedProxies() {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			nets = append(nets, network)
+		}
+	}
+	return nets
+})
+
+// fromTrustedProxy reports whether the request came straight from one of
+// TRUSTED_PROXIES, whose X-Forwarded-* headers can be believed.
+func fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxyNets() {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header that a
+// chain of proxies may have appended to.
+func firstHeaderValue(c *gin.Context, name string) string {
+	value, _, _ := strings.Cut(c.GetHeader(name), ",")
+	return strings.TrimSpace(value)
+}
+
+// requestScheme is the scheme the client used, http or https. Behind a
+// trusted proxy it honours X-Forwarded-Proto, since the proxy terminates TLS.
+func requestScheme(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if fromTrustedProxy(c) {
+		if proto := firstHeaderValue(c, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+	}
+	return scheme
+}
+
+// requestHost is the host the client used, honouring X-Forwarded-Host behind
+// a trusted proxy since the proxy may rewrite the host.
+func requestHost(c *gin.Context) string {
+	if fromTrustedProxy(c) {
+		if forwardedHost := firstHeaderValue(c, "X-Forwarded-Host"); forwardedHost != "" {
+			return forwardedHost
+		}
+	}
+	return c.Request.Host
+}
+
+// requestBaseURL is the scheme and host the client used, e.g.
+// https://api.example.com.
+func requestBaseURL(c *gin.Context) string {
+	return requestScheme(c) + "://" + requestHost(c)
+}
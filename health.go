@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getHealthz reports liveness plus the state of shared safeguards. It stays
+// public and keeps answering during maintenance mode.
+func getHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":       "ok",
+		"retry_budget": queryRetryBudget.state(),
+		"bigquery":     bqClient.status(),
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultHSTSMaxAge = 365 * 24 * 60 * 60
+
+// httpsExemptPaths are probed by the load balancer over plain HTTP, so they
+// answer without a redirect.
+var httpsExemptPaths = map[string]bool{
+	"/":        true,
+	"/healthz": true,
+}
+
+// httpsMiddleware enforces HTTPS when ENV=production and does nothing
+// otherwise. The scheme comes from X-Forwarded-Proto when the request arrives
+// through a trusted proxy. Plain HTTP GET and HEAD requests are redirected to
+// the HTTPS URL; other methods get a 400, since their body has already been
+// sent in the clear. HTTPS responses carry Strict-Transport-Security with
+// max-age HSTS_MAX_AGE seconds (default one year).
+func httpsMiddleware(env string) gin.HandlerFunc {
+	if env != "production" {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	maxAge := envInt("HSTS_MAX_AGE", defaultHSTSMaxAge)
+	hsts := "max-age=" + strconv.Itoa(maxAge) + "; includeSubDomains"
+	fmt.Printf("HTTPS enforced, HSTS max-age %ds\n", maxAge)
+
+	return func(c *gin.Context) {
+		if requestScheme(c) == "https" {
+			c.Header("Strict-Transport-Security", hsts)
+			c.Next()
+			return
+		}
+		if httpsExemptPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		loggerFrom(c.Request.Context()).Warn("Plain HTTP request in production", "method", c.Request.Method, "path", c.Request.URL.Path)
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Redirect(http.StatusMovedPermanently, "https://"+requestHost(c)+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "HTTPS required",
+			"details": "this API only accepts HTTPS requests",
+		})
+	}
+}
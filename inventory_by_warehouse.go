@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// warehouseInventory is the latest stock of one SKU keyed by size, then by
+// warehouse.
+type warehouseInventory struct {
+	bySize     map[string]map[string]int64
+	warehouses []string
+}
+
+func queryInventoryByWarehouse(ctx context.Context, skuId string) (warehouseInventory, error) {
+	inventory := warehouseInventory{bySize: make(map[string]map[string]int64)}
+
+	query, err := newQuery(buildInventoryByWarehouseQuery())
+	if err != nil {
+		return inventory, err
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "sku_id",
+			Value: skuId,
+		},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return inventory, err
+	}
+
+	seen := make(map[string]bool)
+	for {
+		var row struct {
+			Size      bigquery.NullString `bigquery:"size"`
+			Warehouse string              `bigquery:"warehouse"`
+			Quantity  bigquery.NullInt64  `bigquery:"quantity"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return inventory, err
+		}
+
+		size := row.Size.StringVal
+		if inventory.bySize[size] == nil {
+			inventory.bySize[size] = make(map[string]int64)
+		}
+		inventory.bySize[size][row.Warehouse] += row.Quantity.Int64
+		if !seen[row.Warehouse] {
+			seen[row.Warehouse] = true
+			inventory.warehouses = append(inventory.warehouses, row.Warehouse)
+		}
+	}
+
+	sort.Strings(inventory.warehouses)
+	return inventory, nil
+}
+
+// addWarehouseBreakdown returns copies of the metrics rows with
+// available_by_warehouse set. Every row lists every warehouse that holds the
+// SKU, zero-filled where a size is not stocked there, so clients can compare
+// sizes side by side. The input rows may be cached and are left untouched.
+func addWarehouseBreakdown(rows []map[string]interface{}, inventory warehouseInventory) []map[string]interface{} {
+	withBreakdown := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row)+1)
+		for key, value := range row {
+			copied[key] = value
+		}
+		size, _ := row["size"].(string)
+		breakdown := make(map[string]int64, len(inventory.warehouses))
+		for _, warehouse := range inventory.warehouses {
+			breakdown[warehouse] = inventory.bySize[size][warehouse]
+		}
+		copied["available_by_warehouse"] = breakdown
+		withBreakdown[i] = copied
+	}
+	return withBreakdown
+}
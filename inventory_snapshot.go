@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// latestInventoryDateSQL selects the inventory snapshot the metrics queries
+// take stock from, as max_date.
+const latestInventoryDateSQL = `
+		SELECT MAX(date) AS max_date
+		FROM metal-force-400307.staging.stg_xentral__inventory
+		WHERE warehouse IS NOT NULL
+	`
+
+var inventorySnapshotCache = newResultCache("inventory_snapshot_date")
+
+// queryInventorySnapshotDate returns the latest inventory snapshot date, or
+// nil if the inventory table is empty.
+func queryInventorySnapshotDate(ctx context.Context) (bigquery.Value, error) {
+	query, err := newQuery(latestInventoryDateSQL)
+	if err != nil {
+		return nil, err
+	}
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []bigquery.Value
+	err = it.Next(&values)
+	if err == iterator.Done || (err == nil && len(values) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return convertValue(it.Schema[0], values[0]), nil
+}
+
+// getInventorySnapshotDate serves GET /inventory/snapshot-date: the date of
+// the inventory snapshot stock numbers are currently based on, the same one
+// /sku-metrics/:sku_id reports as inventory_as_of.
+func getInventorySnapshotDate(c *gin.Context) {
+	ctx := c.Request.Context()
+	value, hit, err := inventorySnapshotCache.fetch(ctx, "latest", filteredCacheTTL("INVENTORY_SNAPSHOT_CACHE_TTL"), func() (interface{}, error) {
+		return queryInventorySnapshotDate(detachedContext(ctx))
+	})
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"inventory_as_of": value,
+	})
+}
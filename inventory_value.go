@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// inventoryValueGroups are the metrics table columns ?group_by= may name. The
+// value is spliced into the SQL as an identifier, so it must come from here.
+var inventoryValueGroups = []string{"category", "season", "class", "gender", "cluster"}
+
+// getInventoryValue serves GET /inventory/value: the value of the stock on
+// hand, available_count * purchase_price summed over the metrics table.
+// ?category= and ?season= filter the rows, and ?group_by= adds a breakdown by
+// one of inventoryValueGroups. Like /purchase-orders/value-by-month, values
+// are raw amounts in the currency of purchase_price, and unpriced_units
+// counts stock missing from value because it has no purchase_price.
+func getInventoryValue(c *gin.Context) {
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Inventory value requested")
+
+	var v validator
+	groupBy := c.Query("group_by")
+	if groupBy != "" && !slices.Contains(inventoryValueGroups, groupBy) {
+		v.add("group_by", fmt.Sprintf("group_by must be one of %s", strings.Join(inventoryValueGroups, ", ")))
+	}
+	if v.respond(c) {
+		return
+	}
+
+	group := "'all'"
+	if groupBy != "" {
+		group = groupBy
+	}
+	query, err := newQuery(`
+		SELECT
+		  ` + group + ` AS name,
+		  SUM(available_count) AS available_units,
+		  ROUND(SUM(available_count * SAFE_CAST(purchase_price AS FLOAT64)), 2) AS value,
+		  SUM(IF(purchase_price IS NULL, available_count, 0)) AS unpriced_units
+		FROM metal-force-400307.agent.sku_sizes_metrics
+		WHERE available_count > 0
+		  AND (@category = '' OR CAST(category AS STRING) = @category)
+		  AND (@season = '' OR CAST(season AS STRING) = @season)
+		GROUP BY 1
+		ORDER BY value DESC
+	`)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{Name: "category", Value: c.Query("category")},
+		{Name: "season", Value: c.Query("season")},
+	}
+
+	queryStart := time.Now()
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	groups := []map[string]interface{}{}
+	var totalValue, totalUnits, unpricedUnits float64
+	for {
+		var values []bigquery.Value
+		err := it.Next(&values)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+
+		row := make(map[string]interface{})
+		for i, field := range it.Schema {
+			if i < len(values) {
+				row[field.Name] = convertValue(field, values[i])
+			}
+		}
+		value, _ := numericValue(row["value"])
+		units, _ := numericValue(row["available_units"])
+		unpriced, _ := numericValue(row["unpriced_units"])
+		totalValue += value
+		totalUnits += units
+		unpricedUnits += unpriced
+		groups = append(groups, row)
+	}
+	c.Set(queryTimeKey, time.Since(queryStart))
+
+	response := gin.H{
+		"value":           math.Round(totalValue*100) / 100,
+		"available_units": totalUnits,
+		"unpriced_units":  unpricedUnits,
+		"category":        c.Query("category"),
+		"season":          c.Query("season"),
+	}
+	if groupBy != "" {
+		response["group_by"] = groupBy
+		response["groups"] = groups
+	}
+
+	loggerFrom(ctx).Info("Returning inventory value", "groups", len(groups))
+	c.Header("Cache-Control", "private, max-age=300")
+	respondJSON(c, http.StatusOK, response)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+)
+
+// jobLogSize caps how many queries the job log remembers.
+const jobLogSize = 200
+
+// jobRecord is one query the API ran. Running queries have no job ID yet,
+// since the client library only reports it once the job has finished.
+type jobRecord struct {
+	JobID          string    `json:"job_id,omitempty"`
+	Location       string    `json:"location,omitempty"`
+	Route          string    `json:"route,omitempty"`
+	RequestID      string    `json:"request_id,omitempty"`
+	Started        time.Time `json:"started"`
+	DurationMs     int64     `json:"duration_ms"`
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	BytesProcessed *int64    `json:"bytes_processed,omitempty"`
+
+	job *bigquery.Job
+}
+
+// jobLog is a ring buffer of the most recent queries, for correlating API
+// requests with jobs in the BigQuery console.
+type jobLog struct {
+	mu      sync.Mutex
+	records []*jobRecord
+	next    int
+}
+
+var queryJobLog = &jobLog{}
+
+// start records a query launched on behalf of ctx's request and returns its
+// record for finish.
+func (l *jobLog) start(ctx context.Context) *jobRecord {
+	info := requestInfoFrom(ctx)
+	record := &jobRecord{
+		Route:     info.Route,
+		RequestID: info.ID,
+		Started:   time.Now(),
+		Status:    "running",
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) < jobLogSize {
+		l.records = append(l.records, record)
+	} else {
+		l.records[l.next] = record
+	}
+	l.next = (l.next + 1) % jobLogSize
+	return record
+}
+
+// finish records the outcome of the query started as record.
+func (l *jobLog) finish(record *jobRecord, it *bigquery.RowIterator, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record.DurationMs = time.Since(record.Started).Milliseconds()
+	if err != nil {
+		record.Status = "failed"
+		record.Error = err.Error()
+		return
+	}
+	record.Status = "done"
+	if job := it.SourceJob(); job != nil {
+		record.JobID = job.ID()
+		record.Location = job.Location()
+		record.job = job
+	}
+}
+
+// snapshot returns copies of the records, newest first.
+func (l *jobLog) snapshot() []jobRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := make([]jobRecord, 0, len(l.records))
+	for i := 1; i <= len(l.records); i++ {
+		index := (l.next - i + len(l.records)) % len(l.records)
+		records = append(records, *l.records[index])
+	}
+	return records
+}
+
+// setBytesProcessed stores the bytes a finished job processed, looked up
+// lazily since it costs a jobs.get call.
+func (l *jobLog) setBytesProcessed(jobID string, bytes int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, record := range l.records {
+		if record.JobID == jobID {
+			record.BytesProcessed = &bytes
+		}
+	}
+}
+
+// getAdminJobs serves GET /admin/jobs: the most recent queries the API ran,
+// newest first. Bytes processed are fetched from BigQuery for finished jobs
+// that don't have them yet.
+func getAdminJobs(c *gin.Context) {
+	records := queryJobLog.snapshot()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, batchConcurrency)
+	for i := range records {
+		record := &records[i]
+		if record.job == nil || record.BytesProcessed != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			status, err := record.job.Status(c.Request.Context())
+			if err != nil || status.Statistics == nil {
+				return
+			}
+			bytes := status.Statistics.TotalBytesProcessed
+			record.BytesProcessed = &bytes
+			queryJobLog.setBytesProcessed(record.JobID, bytes)
+		}()
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, gin.H{
+		"capacity": jobLogSize,
+		"jobs":     records,
+	})
+}
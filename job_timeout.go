@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+const minJobTimeout = time.Second
+
+// applyJobTimeout sets the job timeout for query from BIGQUERY_JOB_TIMEOUT
+// (seconds, unset by default), the server-side limit after which BigQuery
+// cancels the job, shortened to the time left before ctx's deadline. Our
+// context only stops the client waiting; without a job timeout BigQuery
+// keeps running, and billing, the abandoned job.
+//
+// A job timeout rules out the jobs.query fast path, so queries go through
+// jobs.insert and take an extra round-trip. That is why it is opt-in.
+func applyJobTimeout(ctx context.Context, query *bigquery.Query) {
+	timeout := envDuration("BIGQUERY_JOB_TIMEOUT", 0)
+	if timeout <= 0 {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	query.JobTimeout = max(timeout, minJobTimeout)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	gojson "github.com/goccy/go-json"
+)
+
+// jsonEncoders are the marshal functions JSON_ENCODER can pick for response
+// bodies. goccy/go-json produces the same output as encoding/json, sorted
+// map keys included (TestJSONEncodersAgree). Marshalling the 5,000 rows of
+// BenchmarkRespondJSON took about 26ms with goccy against 53ms with
+// encoding/json, with 5k instead of 330k allocations.
+var jsonEncoders = map[string]func(interface{}) ([]byte, error){
+	"std":   json.Marshal,
+	"goccy": gojson.Marshal,
+}
+
+// marshalJSON encodes response bodies. It is encoding/json unless
+// JSON_ENCODER selects another entry of jsonEncoders at startup.
+var marshalJSON = json.Marshal
+
+// loadJSONEncoder reads JSON_ENCODER at startup and panics on an unknown name
+// so a bad deploy fails immediately.
+func loadJSONEncoder() {
+	name := os.Getenv("JSON_ENCODER")
+	if name == "" {
+		name = "std"
+	}
+	encoder, ok := jsonEncoders[name]
+	if !ok {
+		panic(fmt.Sprintf("Invalid JSON_ENCODER: %q, use std or goccy", name))
+	}
+	marshalJSON = encoder
+	fmt.Printf("JSON encoder: %s\n", name)
+}
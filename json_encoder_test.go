@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// benchmarkRows builds n rows shaped like the /sku-metrics response: a few
+// strings, the integer counters and the monthly sold columns.
+func benchmarkRows(n int) []map[string]interface{} {
+	months := []string{"january", "february", "march", "april", "may", "june", "july", "august", "september", "october", "november", "december"}
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		row := map[string]interface{}{
+			"sku":                  fmt.Sprintf("SKU%06d", i/8),
+			"name":                 fmt.Sprintf("Product %d with a longer display name", i/8),
+			"size":                 []string{"XS", "S", "M", "L", "XL", "XXL", "38.5", "ONE SIZE"}[i%8],
+			"product_id":           int64(100000 + i),
+			"available_count":      int64(i % 97),
+			"purchased_count":      int64(i % 13),
+			"sold_last_24_months":  int64(i % 211),
+			"open_orders_quantity": int64(i % 5),
+			"sell_through":         float64(i%100) / 100,
+			"lead_time":            "45",
+			"cluster":              nil,
+			"inventory_as_of":      "2026-10-15",
+		}
+		for m, month := range months {
+			row["sold_"+month] = int64((i + m) % 17)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// BenchmarkRespondJSON measures respondJSON on a 5,000-row /sku-metrics-like
+// body with each entry of jsonEncoders:
+//
+//	go test -run ^$ -bench RespondJSON -benchmem
+func BenchmarkRespondJSON(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	rows := benchmarkRows(5000)
+	defer func(original func(interface{}) ([]byte, error)) { marshalJSON = original }(marshalJSON)
+
+	for _, name := range []string{"std", "goccy"} {
+		b.Run(name, func(b *testing.B) {
+			marshalJSON = jsonEncoders[name]
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				recorder := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(recorder)
+				c.Request = httptest.NewRequest(http.MethodGet, "/sku-metrics", nil)
+				respondJSON(c, http.StatusOK, rows)
+				if recorder.Code != http.StatusOK {
+					b.Fatalf("status %d", recorder.Code)
+				}
+			}
+		})
+	}
+}
+
+// TestJSONEncodersAgree checks every encoder produces the same body, which
+// is what makes JSON_ENCODER safe to switch.
+func TestJSONEncodersAgree(t *testing.T) {
+	rows := benchmarkRows(50)
+	want, err := jsonEncoders["std"](rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, encoder := range jsonEncoders {
+		got, err := encoder(rows)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s output differs from encoding/json", name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces the value of a redacted parameter in logs.
+const redactedValue = "***"
+
+// defaultRedactedParams are always redacted: export links carry the API
+// token as ?token=.
+var defaultRedactedParams = []string{"token"}
+
+// redactedParams is defaultRedactedParams plus LOG_REDACT_PARAMS, a
+// comma-separated list of query parameter names, matched case-insensitively.
+var redactedParams = sync.OnceValue(func() map[string]bool {
+	params := make(map[string]bool)
+	for _, name := range defaultRedactedParams {
+		params[name] = true
+	}
+	for _, name := range strings.Split(os.Getenv("LOG_REDACT_PARAMS"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			params[name] = true
+		}
+	}
+	return params
+})
+
+// redactedTokenPrefix is how much of a rejected token redactedToken keeps,
+// enough to tell a truncated token from a wrong one.
+const redactedTokenPrefix = 4
+
+// redactedToken renders a credential for a log line as its first few
+// characters followed by ***. Short values are redacted entirely.
+func redactedToken(token string) string {
+	if len(token) <= 2*redactedTokenPrefix {
+		return redactedValue
+	}
+	return token[:redactedTokenPrefix] + redactedValue
+}
+
+// redactedQuery renders query for a log line, sorted by name, with the
+// values of redactedParams replaced by ***.
+func redactedQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		redact := redactedParams()[strings.ToLower(name)]
+		for _, value := range query[name] {
+			if redact {
+				value = redactedValue
+			} else {
+				value = url.QueryEscape(value)
+			}
+			parts = append(parts, url.QueryEscape(name)+"="+value)
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits which incoming request IDs are reused, so a client
+// can't inject arbitrary text into the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var baseLogger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+// debugRows turns on the dumps of every row and field the metrics queries
+// read. They swamp the logs and slow large reads down, so they stay off
+// unless DEBUG=true.
+var debugRows bool
+
+type loggerContextKey struct{}
+
+// requestInfo identifies the request a context belongs to, for records kept
+// after it completes, such as the BigQuery job log. Client is the alias of
+// the authenticated token, empty until the auth middleware has run.
+type requestInfo struct {
+	ID     string
+	Route  string
+	Client string
+}
+
+type requestInfoContextKey struct{}
+
+// requestInfoFrom returns the request's ID and route, or a zero requestInfo
+// outside a request.
+func requestInfoFrom(ctx context.Context) requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey{}).(requestInfo)
+	return info
+}
+
+// setRequestClient records the authenticated token's alias in the request's
+// requestInfo.
+func setRequestClient(c *gin.Context, alias string) {
+	ctx := c.Request.Context()
+	info := requestInfoFrom(ctx)
+	info.Client = alias
+	c.Request = c.Request.WithContext(context.WithValue(ctx, requestInfoContextKey{}, info))
+}
+
+// loggerFrom returns the request-scoped logger stored by
+// requestLoggerMiddleware, or the base logger outside a request.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return baseLogger
+}
+
+// detachedContext returns a context for work shared beyond the request, like
+// a cache fill: it keeps the logger and request info of ctx so the work can
+// be traced to the request that started it, but not its cancellation,
+// deadline or per-request state.
+func detachedContext(ctx context.Context) context.Context {
+	detached := context.WithValue(context.Background(), loggerContextKey{}, loggerFrom(ctx))
+	return context.WithValue(detached, requestInfoContextKey{}, requestInfoFrom(ctx))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestLoggerMiddleware tags every request with an ID, reusing a valid
+// incoming X-Request-ID so calls can be traced across services, and echoes
+// it in the response. The child logger carrying the ID goes into the request
+// context for loggerFrom, and one line is logged when the request completes,
+// with the query string passed through redactedQuery.
+func requestLoggerMiddleware(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if !requestIDPattern.MatchString(requestID) {
+		requestID = newRequestID()
+	}
+	c.Header(requestIDHeader, requestID)
+
+	logger := baseLogger.With(
+		"request_id", requestID,
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+	)
+	ctx := context.WithValue(c.Request.Context(), loggerContextKey{}, logger)
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	ctx = context.WithValue(ctx, requestInfoContextKey{}, requestInfo{ID: requestID, Route: route})
+	c.Request = c.Request.WithContext(ctx)
+
+	start := time.Now()
+	c.Next()
+
+	attrs := []interface{}{
+		"status", c.Writer.Status(),
+		"duration_ms", time.Since(start).Milliseconds(),
+		"client_ip", c.ClientIP(),
+	}
+	if c.Request.URL.RawQuery != "" {
+		attrs = append(attrs, "query", redactedQuery(c.Request.URL.Query()))
+	}
+	logger.Info("Request completed", attrs...)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,7 +16,7 @@ import (
 )
 
 var (
-	bqClient *bigquery.Client
+	bqClient *bigQueryClient
 )
 
 func loadEnvFile() {
@@ -46,7 +47,61 @@ func loadEnvFile() {
 	}
 }
 
+// defaultTrustedProxies are the Google Front End / load balancer ranges our
+// traffic arrives through, plus loopback for a local reverse proxy.
+var defaultTrustedProxies = []string{
+	"35.191.0.0/16",
+	"130.211.0.0/22",
+	"127.0.0.1",
+	"::1",
+}
+
+// trustedProxies reads TRUSTED_PROXIES as a comma-separated list of IPs or
+// CIDRs, falling back to defaultTrustedProxies when unset.
+func trustedProxies() []string {
+	value := os.Getenv("TRUSTED_PROXIES")
+	if value == "" {
+		return defaultTrustedProxies
+	}
+
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// ginMode picks release mode in production and debug mode otherwise. GIN_MODE
+// can override it, except that debug mode is never enabled in production.
+func ginMode(env string) string {
+	mode := gin.DebugMode
+	if env == "production" {
+		mode = gin.ReleaseMode
+	}
+
+	switch override := os.Getenv("GIN_MODE"); override {
+	case "":
+	case gin.DebugMode:
+		if env == "production" {
+			fmt.Println("WARNING: Ignoring GIN_MODE=debug in production")
+		} else {
+			mode = override
+		}
+	case gin.ReleaseMode, gin.TestMode:
+		mode = override
+	default:
+		fmt.Printf("WARNING: Ignoring invalid GIN_MODE: %s\n", override)
+	}
+	return mode
+}
+
 func main() {
+	// -check verifies credentials and BigQuery connectivity, then exits
+	check := flag.Bool("check", false, "run a BigQuery self-test query and exit without starting the server")
+	flag.Parse()
+
 	// Load .env file if it exists
 	loadEnvFile()
 	
@@ -55,79 +110,143 @@ func main() {
 	fmt.Printf("Starting server - Environment: '%s'\n", env)
 	fmt.Printf("Port: '%s'\n", port)
 	fmt.Printf("Environment check: ENV=='production' = %t\n", env == "production")
+	debugRows = os.Getenv("DEBUG") == "true"
+	fmt.Printf("Per-row debug logging: %t\n", debugRows)
 
 	// Initialize BigQuery client
 	ctx := context.Background()
-	var err error
 
-	serviceAccountPath := "./golang-api-bigquery.json"
+	// Credentials come from Secret Manager, the key file or ADC; they are
+	// resolved once and reused when the client reconnects
+	credentials, err := bigQueryCredentials(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load BigQuery credentials: %v", err))
+	}
 
-	fmt.Printf("Using service account: %s\n", serviceAccountPath)
+	loadAllowedDatasets()
+	loadPublicPaths()
+	loadJSONEncoder()
+	loadAPITokens()
+	queryRetryBudget = newRetryBudget()
+	queryConcurrency = newQueryLimiter()
+	loadDateLayout()
 
-	if _, err := os.Stat(serviceAccountPath); os.IsNotExist(err) {
-		panic(fmt.Sprintf("Service account file does not exist at: %s", serviceAccountPath))
+	if persistCacheEnabled() {
+		if err := loadCaches(persistCachePath()); err != nil {
+			fmt.Printf("WARNING: Failed to load persisted caches: %v\n", err)
+		}
 	}
 
-	bqClient, err = bigquery.NewClient(ctx, "metal-force-400307",
-		option.WithCredentialsFile(serviceAccountPath))
+	bqClient, err = newBigQueryClient(ctx, func(ctx context.Context) (*bigquery.Client, error) {
+		httpClient, err := newBigQueryHTTPClient(ctx, credentials...)
+		if err != nil {
+			return nil, err
+		}
+		client, err := bigquery.NewClient(ctx, bigQueryProject, option.WithHTTPClient(httpClient))
+		if err != nil || !storageReadEnabled() {
+			return client, err
+		}
+		if err := client.EnableStorageReadClient(ctx, credentials...); err != nil {
+			client.Close()
+			return nil, err
+		}
+		return client, nil
+	})
 
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create BigQuery client: %v", err))
 	}
 	fmt.Println("BigQuery client initialized")
+	if *check {
+		code := runSelfCheck(ctx)
+		bqClient.Close()
+		os.Exit(code)
+	}
 	defer bqClient.Close()
 
-	gin.SetMode(gin.ReleaseMode)
+	gin.SetMode(ginMode(env))
+	fmt.Printf("Gin mode: %s\n", gin.Mode())
 	router := gin.New()
 
+	// Only honour X-Forwarded-For from known proxies so c.ClientIP() is the
+	// real client rather than the load balancer
+	proxies := trustedProxies()
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		panic(fmt.Sprintf("Invalid TRUSTED_PROXIES: %v", err))
+	}
+	fmt.Printf("Trusted proxies: %s\n", strings.Join(proxies, ", "))
+
+	// Tag each request with an ID and a logger carrying it, before anything
+	// else runs
+	router.Use(requestLoggerMiddleware)
+
+	// CORS policy per environment from CORS_POLICY or CORS_POLICY_FILE
+	corsConfig := loadCORSConfig(env)
+
+	// Server-Timing breaks the response time down for browser devtools
+	router.Use(serverTimingMiddleware(corsConfig))
+
+	// Accept: application/problem+json turns error bodies into RFC 7807
+	// problem details
+	router.Use(problemJSONMiddleware)
+
+	// Production only serves HTTPS; plain HTTP is redirected or rejected
+	router.Use(httpsMiddleware(env))
+
+	// CORS runs before auth so preflight requests, which carry no token, are
+	// answered and 401s still carry the CORS headers browsers need to read them
+	router.Use(cors.New(corsConfig))
+
 	// Bearer token authentication middleware
 	router.Use(func(c *gin.Context) {
-		// Skip auth for root endpoint
-		if c.Request.URL.Path == "/" {
+		// Skip auth for public endpoints, / and /healthz unless PUBLIC_PATHS
+		// says otherwise
+		if isPublicPath(c.Request.URL.Path) {
 			c.Next()
 			return
 		}
 
 		authHeader := c.GetHeader("Authorization")
-		userAgent := c.GetHeader("User-Agent")
-		origin := c.GetHeader("Origin")
-		referer := c.GetHeader("Referer")
-		
-		fmt.Printf("=== AUTH DEBUG ===\n")
-		fmt.Printf("Method: %s\n", c.Request.Method)
-		fmt.Printf("Path: %s\n", c.Request.URL.Path)
-		fmt.Printf("Authorization Header: '%s'\n", authHeader)
-		fmt.Printf("User-Agent: '%s'\n", userAgent)
-		fmt.Printf("Origin: '%s'\n", origin)
-		fmt.Printf("Referer: '%s'\n", referer)
-		fmt.Printf("Remote Address: %s\n", c.ClientIP())
-		fmt.Printf("==================\n")
-
-		// Check for Bearer token
-		if authHeader == "" {
-			fmt.Printf("AUTH: No Authorization header provided\n")
-			c.AbortWithStatusJSON(401, gin.H{
-				"error": "Unauthorized",
-				"message": "Bearer token required. Use: Authorization: Bearer YOUR_TOKEN",
-			})
-			return
-		}
 
-		// Extract token from "Bearer TOKEN"
-		if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
-			fmt.Printf("AUTH: Invalid Authorization format: %s\n", authHeader)
-			c.AbortWithStatusJSON(401, gin.H{
-				"error": "Unauthorized", 
-				"message": "Invalid Authorization format. Use: Authorization: Bearer YOUR_TOKEN",
-			})
-			return
-		}
+		// The token can come from Authorization: Bearer, then X-Api-Key for
+		// clients whose framework reserves Authorization, then ?token= on
+		// export downloads; the first one present is the one checked
+		apiKey := c.GetHeader(apiKeyHeader)
+		var token string
+		if authHeader == "" && apiKey != "" {
+			fmt.Printf("AUTH: Token supplied via %s header\n", apiKeyHeader)
+			token = apiKey
+		} else if authHeader == "" && queryTokenAllowed(c) {
+			// Export download links carry the token in the URL
+			fmt.Printf("AUTH: Token supplied via ?token= query parameter for export\n")
+			token = c.Query("token")
+		} else {
+			// Check for Bearer token
+			if authHeader == "" {
+				fmt.Printf("AUTH: No Authorization header provided\n")
+				recordAuthDenied(deniedMissingToken, "")
+				c.AbortWithStatusJSON(401, gin.H{
+					"error": "Unauthorized",
+					"message": "Bearer token required. Use: Authorization: Bearer YOUR_TOKEN or X-Api-Key: YOUR_TOKEN",
+				})
+				return
+			}
 
-		token := authHeader[7:] // Remove "Bearer " prefix
-		validToken := os.Getenv("API_TOKEN")
-		
-		if validToken == "" {
-			fmt.Printf("AUTH: No API_TOKEN environment variable set\n")
+			// Extract token from "Bearer TOKEN"
+			if len(authHeader) < 7 || authHeader[:7] != "Bearer " {
+				fmt.Printf("AUTH: Invalid Authorization format: %s\n", redactedToken(authHeader))
+				recordAuthDenied(deniedInvalidToken, "")
+				c.AbortWithStatusJSON(401, gin.H{
+					"error": "Unauthorized", 
+					"message": "Invalid Authorization format. Use: Authorization: Bearer YOUR_TOKEN",
+				})
+				return
+			}
+
+			token = authHeader[7:] // Remove "Bearer " prefix
+		}
+		if len(apiTokens) == 0 {
+			fmt.Printf("AUTH: No API_TOKEN or API_TOKENS environment variable set\n")
 			c.AbortWithStatusJSON(500, gin.H{
 				"error": "Server configuration error",
 				"message": "API token not configured",
@@ -135,8 +254,10 @@ func main() {
 			return
 		}
 
-		if token != validToken {
-			fmt.Printf("AUTH: Invalid token provided: %s\n", token)
+		entry, ok := lookupToken(token)
+		if !ok {
+			fmt.Printf("AUTH: Invalid token provided: %s\n", redactedToken(token))
+			recordAuthDenied(deniedInvalidToken, "")
 			c.AbortWithStatusJSON(401, gin.H{
 				"error": "Unauthorized",
 				"message": "Invalid bearer token",
@@ -144,41 +265,91 @@ func main() {
 			return
 		}
 
-		fmt.Printf("AUTH: Valid token provided, allowing access\n")
+		fmt.Printf("AUTH: Valid %s token %s provided, allowing access\n", entry.Role, entry.Alias)
+		c.Set(authTokenKey, entry)
+		setRequestClient(c, entry.Alias)
 		c.Next()
 	})
+	router.Use(serverTimingMark("auth"))
 
-	// Simple CORS for development
-	router.Use(cors.Default())
-	fmt.Println("Authentication: Bearer token required for all endpoints except /")
-	apiToken := os.Getenv("API_TOKEN")
-	if apiToken != "" {
-		fmt.Printf("API_TOKEN configured: %s\n", apiToken)
-	} else {
+	// Malformed or oversized query strings are rejected before any handler
+	router.Use(queryValidationMiddleware())
+
+	// Conflicting output parameters, like ?format=csv&transform=, get a 400
+	router.Use(outputFormatMiddleware)
+
+	// Maintenance mode turns data endpoints off during backfills
+	setMaintenanceMode(os.Getenv("MAINTENANCE_MODE") == "true")
+	router.Use(maintenanceMiddleware())
+
+	// Clients can shorten the query deadline via X-Request-Timeout-Ms
+	router.Use(requestTimeoutMiddleware())
+
+	// Admins can ask for the executed SQL via ?explain_sql=true
+	router.Use(explainMiddleware)
+
+	// ?nocache=true and ?refresh=true bypass the result caches
+	router.Use(cacheModeMiddleware)
+	fmt.Printf("Authentication: Bearer token required for all endpoints except %s\n", strings.Join(publicPaths, ", "))
+	if len(apiTokens) == 0 {
 		fmt.Println("WARNING: API_TOKEN environment variable not set!")
 	}
+	checkTokenStrength(env)
 
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "Server is running"})
 	})
 
+	router.GET("/healthz", getHealthz)
+	router.GET("/ping", getPing)
+
 	router.GET("/purchase-orders", getPurchaseOrders)
+	router.GET("/purchase-orders/value-by-month", getPurchaseOrderValueByMonth)
+	router.GET("/inventory/value", getInventoryValue)
+	router.GET("/inventory/snapshot-date", getInventorySnapshotDate)
+	router.GET("/dashboard", getDashboard)
 	router.GET("/all-purchase-orders", getAllPurchaseOrders)
 	router.GET("/sku-metrics", getSkuMetrics)
+	router.GET("/sku-metrics/mto", getSkuMetricsMTO)
+	router.GET("/sku-metrics/fingerprint", getSkuMetricsFingerprint)
+	router.GET("/sku-metrics/overstock-risk", getSkuMetricsOverstockRisk)
+	router.GET("/sku-metrics/cluster/:cluster", getSkuMetricsCluster)
 	router.GET("/sku-metrics/:sku_id", getSkuMetricsSingle)
+	router.GET("/sku-metrics/:sku_id/stockout-risk", getSkuStockoutRisk)
+	router.POST("/sku-metrics/:sku_id/gap", postSkuStockGap)
+	router.GET("/sku-metrics/:sku_id/missing-sizes", getSkuMissingSizes)
+	router.GET("/skus/search", getSkuSearch)
+	router.GET("/skus/:sku_id/exists", getSkuExists)
+
+	// Every route takes a read token unless it is wrapped in requireAdmin.
+	// Writes to shared state need admin: /sku-lists overwrites lists other
+	// clients reference, and /exports dumps the whole table to the export
+	// bucket. /batch and /jobs stay on read, as each sub-request goes back
+	// through the router with the caller's credentials and so still meets
+	// its own route's role.
+	router.POST("/sku-lists", requireAdmin, postSkuList)
+	router.POST("/batch", batchHandler(router))
+	router.POST("/jobs", asyncJobHandler(router))
+	router.GET("/jobs/:id", getAsyncJob)
+	router.GET("/metrics", getMetrics)
+	router.POST("/exports", requireAdmin, postExport)
+	router.GET("/exports/:id", requireAdmin, getExport)
+	router.POST("/admin/warm/:sku_id", requireAdmin, postWarmSku)
+	router.GET("/admin/jobs", requireAdmin, getAdminJobs)
 
 	if env == "production" {
 		fmt.Printf("Starting server in production mode on port %s\n", port)
-		if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-			panic(fmt.Sprintf("Failed to start server: %v", err))
-		}
 	} else {
 		if port == "" {
 			port = "8011"
 		}
 		fmt.Printf("Starting server in development mode on port %s\n", port)
-		if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
-			panic(fmt.Sprintf("Failed to start server: %v", err))
+	}
+	serveUntilSignal(newHTTPServer(fmt.Sprintf(":%s", port), router))
+
+	if persistCacheEnabled() {
+		if err := saveCaches(persistCachePath()); err != nil {
+			fmt.Printf("WARNING: Failed to persist caches: %v\n", err)
 		}
 	}
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultMaintenanceRetryAfter = 300
+
+var maintenanceMode atomic.Bool
+
+// maintenanceExemptPaths keep responding during maintenance so health checks
+// stay green while the data endpoints are switched off.
+var maintenanceExemptPaths = map[string]bool{
+	"/":        true,
+	"/healthz": true,
+}
+
+// setMaintenanceMode switches maintenance mode and logs the transition. It is
+// safe to call from any goroutine.
+func setMaintenanceMode(enabled bool) {
+	if maintenanceMode.Swap(enabled) == enabled {
+		return
+	}
+	if enabled {
+		fmt.Println("MAINTENANCE: Entering maintenance mode, data endpoints will return 503")
+	} else {
+		fmt.Println("MAINTENANCE: Leaving maintenance mode, data endpoints are serving again")
+	}
+}
+
+// maintenanceRetryAfter is the Retry-After value in seconds, configurable via
+// MAINTENANCE_RETRY_AFTER.
+func maintenanceRetryAfter() int {
+	if value := os.Getenv("MAINTENANCE_RETRY_AFTER"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return seconds
+		}
+		fmt.Printf("WARNING: Ignoring invalid MAINTENANCE_RETRY_AFTER: %s\n", value)
+	}
+	return defaultMaintenanceRetryAfter
+}
+
+func maintenanceMiddleware() gin.HandlerFunc {
+	retryAfter := strconv.Itoa(maintenanceRetryAfter())
+
+	return func(c *gin.Context) {
+		if !maintenanceMode.Load() || maintenanceExemptPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", retryAfter)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Service Unavailable",
+			"message": "The API is in maintenance mode while data is being reloaded, please retry later",
+		})
+	}
+}
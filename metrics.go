@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// getMetrics serves /metrics in the Prometheus text exposition format.
+func getMetrics(c *gin.Context) {
+	var b strings.Builder
+	writeCacheMetrics(&b)
+	writeAuthMetrics(&b)
+	c.Data(http.StatusOK, metricsContentType, []byte(b.String()))
+}
+
+func writeMetricHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeCacheMetrics(b *strings.Builder) {
+	writeMetricHeader(b, "api_cache_entries", "gauge", "Number of entries currently held in the cache.")
+	for _, rc := range caches {
+		fmt.Fprintf(b, "api_cache_entries{cache=%q} %d\n", rc.name, rc.size())
+	}
+
+	writeMetricHeader(b, "api_cache_hits_total", "counter", "Cache lookups served from the cache.")
+	for _, rc := range caches {
+		fmt.Fprintf(b, "api_cache_hits_total{cache=%q} %d\n", rc.name, rc.hits.Load())
+	}
+
+	writeMetricHeader(b, "api_cache_misses_total", "counter", "Cache lookups that had to query BigQuery.")
+	for _, rc := range caches {
+		fmt.Fprintf(b, "api_cache_misses_total{cache=%q} %d\n", rc.name, rc.misses.Load())
+	}
+
+	writeMetricHeader(b, "api_cache_evictions_total", "counter", "Cache entries removed because they expired or the cache was full.")
+	for _, rc := range caches {
+		fmt.Fprintf(b, "api_cache_evictions_total{cache=%q} %d\n", rc.name, rc.evictions.Load())
+	}
+
+	writeMetricHeader(b, "api_cache_hit_ratio", "gauge", "Share of cache lookups served from the cache since startup.")
+	for _, rc := range caches {
+		hits, misses := rc.hits.Load(), rc.misses.Load()
+		ratio := 0.0
+		if hits+misses > 0 {
+			ratio = float64(hits) / float64(hits+misses)
+		}
+		fmt.Fprintf(b, "api_cache_hit_ratio{cache=%q} %g\n", rc.name, ratio)
+	}
+}
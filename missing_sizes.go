@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// clusterSizeStock is one size seen in a SKU's cluster, with that SKU's
+// stock of it.
+type clusterSizeStock struct {
+	Size           string              `bigquery:"size"`
+	Cluster        bigquery.NullString `bigquery:"cluster"`
+	AvailableCount float64             `bigquery:"available_count"`
+	PurchasedCount float64             `bigquery:"purchased_count"`
+	Listed         bool                `bigquery:"listed"`
+}
+
+// missingSize is one size in the missing-sizes response. Listed tells a
+// size the SKU has a metrics row for, sold out with nothing on order, from
+// one it was never stocked in.
+type missingSize struct {
+	Size   string `json:"size"`
+	Listed bool   `json:"listed"`
+}
+
+// getSkuMissingSizes serves GET /sku-metrics/:sku_id/missing-sizes, the
+// sizes a SKU should carry but has none of: zero available_count and zero
+// purchased_count (on order). Unlike low stock, nothing is coming in to fix
+// these. The sizes it should carry are the size run given as ?sizes=S,M,L,
+// or by default every size seen across the SKUs of its cluster.
+func getSkuMissingSizes(c *gin.Context) {
+	skuId := normalizeSkuID(c.Param("sku_id"))
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Missing sizes requested", "sku", skuId)
+
+	var v validator
+	var sizeRun []string
+	if value, ok := c.GetQuery("sizes"); ok {
+		for _, size := range strings.Split(value, ",") {
+			if size = strings.TrimSpace(size); size != "" {
+				sizeRun = append(sizeRun, normalizeSize(size))
+			}
+		}
+		if len(sizeRun) == 0 {
+			v.add("sizes", "sizes must list at least one size, e.g. S,M,L")
+		}
+	}
+	if v.respond(c) {
+		return
+	}
+
+	sizes, err := queryClusterSizeStock(ctx, skuId)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if len(sizes) == 0 {
+		exists, err := skuExists(ctx, skuId)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "SKU not found",
+				"sku":    skuId,
+				"exists": false,
+			})
+			return
+		}
+	}
+
+	bySize := make(map[string]clusterSizeStock, len(sizes))
+	var cluster interface{}
+	for _, size := range sizes {
+		bySize[size.Size] = size
+		if size.Cluster.Valid {
+			cluster = size.Cluster.StringVal
+		}
+	}
+
+	source := "request"
+	if sizeRun == nil {
+		source = "cluster"
+		for _, size := range sizes {
+			sizeRun = append(sizeRun, size.Size)
+		}
+	}
+	sort.SliceStable(sizeRun, func(i, j int) bool {
+		return sizeLess(sizeRun[i], sizeRun[j])
+	})
+
+	missing := []missingSize{}
+	seen := make(map[string]bool, len(sizeRun))
+	for _, size := range sizeRun {
+		if seen[size] {
+			continue
+		}
+		seen[size] = true
+		stock := bySize[size]
+		if stock.AvailableCount == 0 && stock.PurchasedCount == 0 {
+			missing = append(missing, missingSize{Size: size, Listed: stock.Listed})
+		}
+	}
+
+	loggerFrom(ctx).Info("Returning missing sizes", "sku", skuId, "size_run", source, "expected", len(seen), "missing", len(missing))
+	c.Header("Cache-Control", "private, max-age=300")
+	respondJSON(c, http.StatusOK, gin.H{
+		"sku":           skuId,
+		"cluster":       cluster,
+		"size_run":      source,
+		"expected":      len(seen),
+		"missing_sizes": missing,
+	})
+}
+
+// queryClusterSizeStock returns every normalized size carried by a SKU of
+// skuId's cluster, or only the SKU's own sizes if it has no cluster, with
+// skuId's available and on-order units of each.
+func queryClusterSizeStock(ctx context.Context, skuId string) ([]clusterSizeStock, error) {
+	query, err := newQuery(`
+		WITH target AS (
+		  SELECT ANY_VALUE(CAST(cluster AS STRING)) AS cluster
+		  FROM metal-force-400307.agent.sku_sizes_metrics
+		  WHERE sku = @sku_id
+		)
+		SELECT
+		  ` + normalizedSizeSQL("a.size") + ` AS size,
+		  ANY_VALUE(target.cluster) AS cluster,
+		  CAST(IFNULL(SUM(IF(a.sku = @sku_id, a.available_count, 0)), 0) AS FLOAT64) AS available_count,
+		  CAST(IFNULL(SUM(IF(a.sku = @sku_id, a.purchased_count, 0)), 0) AS FLOAT64) AS purchased_count,
+		  COUNTIF(a.sku = @sku_id) > 0 AS listed
+		FROM metal-force-400307.agent.sku_sizes_metrics a
+		CROSS JOIN target
+		WHERE a.sku = @sku_id OR CAST(a.cluster AS STRING) = target.cluster
+		GROUP BY 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "sku_id",
+			Value: skuId,
+		},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []clusterSizeStock
+	for {
+		var size clusterSizeStock
+		err := it.Next(&size)
+		if err == iterator.Done {
+			return sizes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+}
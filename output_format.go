@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// outputFormats are the values ?format= accepts on row endpoints.
+var outputFormats = []string{"json", "csv", "ndjson", "arrow", "parquet"}
+
+// responseFormat is the format respondRows writes: ?format= when given,
+// else arrow or parquet when the Accept header asks for them, else json.
+// ?format= takes precedence because Accept is often set by the HTTP library
+// rather than chosen by the client.
+func responseFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+	if format := acceptedFormat(c); format != "" {
+		return format
+	}
+	return "json"
+}
+
+// outputFormatMiddleware rejects GET requests whose output parameters
+// contradict each other, instead of silently dropping one of them:
+//
+//   - ?format= must be one of outputFormats
+//   - ?bom=true, ?delimiter= and ?decimal= shape CSV and need format=csv
+//   - ?transform= and ?omitempty=true shape JSON rows and can't be combined
+//     with csv, arrow or parquet, which keep the schema's fixed columns
+//
+// The format checked is the one responseFormat resolves, so an Accept header
+// asking for Arrow counts too. Other methods are left alone, since POST
+// /exports gives ?format= and ?delimiter= a meaning of its own.
+func outputFormatMiddleware(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.Next()
+		return
+	}
+
+	var v validator
+	format := responseFormat(c)
+	if !slices.Contains(outputFormats, format) {
+		v.add("format", "format must be json, csv, ndjson, arrow or parquet")
+	} else if format != "csv" {
+		if c.Query("bom") == "true" {
+			v.add("bom", "bom=true only applies to format=csv")
+		}
+		for _, param := range []string{"delimiter", "decimal"} {
+			if _, ok := c.GetQuery(param); ok {
+				v.add(param, param+" only applies to format=csv")
+			}
+		}
+	}
+	if format == "csv" || format == "arrow" || format == "parquet" {
+		if c.Query("transform") != "" {
+			v.add("transform", "transform can't be combined with format="+format)
+		}
+		if c.Query("omitempty") == "true" {
+			v.add("omitempty", "omitempty can't be combined with format="+format)
+		}
+	}
+	if v.respond(c) {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
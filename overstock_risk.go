@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultOverstockFactor = 2.0
+
+	// catalogSoldMonths is the window sold_last_24_months covers in the
+	// metrics table.
+	catalogSoldMonths = 24
+)
+
+// sizeOverstockRisk is one flagged SKU size, with every input of the check so
+// buyers can verify it.
+type sizeOverstockRisk struct {
+	Sku             string   `json:"sku"`
+	Size            string   `json:"size"`
+	AvailableCount  float64  `json:"available_count"`
+	PurchasedCount  float64  `json:"purchased_count"`
+	Supply          float64  `json:"supply"`
+	DailyDemand     float64  `json:"daily_demand"`
+	LeadTimeDays    float64  `json:"lead_time_days"`
+	ProjectedDemand float64  `json:"projected_demand"`
+	ExcessUnits     float64  `json:"excess_units"`
+	SupplyToDemand  *float64 `json:"supply_to_demand"`
+}
+
+// overstockFactor is OVERSTOCK_FACTOR, the default for ?factor=.
+func overstockFactor() float64 {
+	value := os.Getenv("OVERSTOCK_FACTOR")
+	if value == "" {
+		return defaultOverstockFactor
+	}
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil || factor <= 0 {
+		fmt.Printf("WARNING: Ignoring invalid OVERSTOCK_FACTOR: %s\n", value)
+		return defaultOverstockFactor
+	}
+	return factor
+}
+
+// getSkuMetricsOverstockRisk serves GET /sku-metrics/overstock-risk, the
+// mirror of stockout-risk across the catalog. A size is flagged when it has
+// units on order and
+//
+//	daily_demand     = sold_last_24_months / days in 24 months
+//	projected_demand = daily_demand * lead_time_days
+//	supply           = available_count + purchased_count
+//	supply > factor * projected_demand
+//
+// factor comes from ?factor= or OVERSTOCK_FACTOR (default 2). lead_time from
+// the metrics table is read as days and can be overridden for every row via
+// ?lead_time_days=; rows without either are skipped. Results are sorted by
+// excess_units (supply - projected_demand), support ?list= and
+// ?limit=/?offset=, and the unpaged count is in X-Total-Count.
+func getSkuMetricsOverstockRisk(c *gin.Context) {
+	loggerFrom(c.Request.Context()).Info("Overstock risk requested")
+
+	var v validator
+	factor := overstockFactor()
+	if value := c.Query("factor"); value != "" {
+		var err error
+		factor, err = strconv.ParseFloat(value, 64)
+		if err != nil || factor <= 0 {
+			v.add("factor", "factor must be a positive number")
+		}
+	}
+	var leadTimeOverride float64
+	if value := c.Query("lead_time_days"); value != "" {
+		var err error
+		leadTimeOverride, err = strconv.ParseFloat(value, 64)
+		if err != nil || leadTimeOverride <= 0 {
+			v.add("lead_time_days", "lead_time_days must be a positive number")
+		}
+	}
+	page := parsePagination(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	results, ok := fetchSkuMetrics(c)
+	if !ok {
+		return
+	}
+
+	windowDays := catalogSoldMonths * daysPerMonth
+	flagged := []sizeOverstockRisk{}
+	skipped := 0
+	for _, row := range results.Rows {
+		leadTimeDays := leadTimeOverride
+		if leadTimeDays == 0 {
+			var ok bool
+			if leadTimeDays, ok = leadTimeValue(row["lead_time"]); !ok {
+				skipped++
+				continue
+			}
+		}
+		if risk, ok := checkOverstock(row, windowDays, leadTimeDays, factor); ok {
+			flagged = append(flagged, risk)
+		}
+	}
+	sort.SliceStable(flagged, func(i, j int) bool {
+		return flagged[i].ExcessUnits > flagged[j].ExcessUnits
+	})
+
+	sizes := flagged[min(page.Offset, len(flagged)):]
+	if page.Limit > 0 && len(sizes) > page.Limit {
+		sizes = sizes[:page.Limit]
+	}
+
+	loggerFrom(c.Request.Context()).Info("Returning overstocked sizes", "sizes", len(sizes), "total", len(flagged), "skipped_no_lead_time", skipped)
+	c.Header("X-Total-Count", strconv.Itoa(len(flagged)))
+	page.setLinkHeader(c, len(sizes), len(flagged))
+	c.Header("Cache-Control", "private, max-age=300")
+	respondJSON(c, http.StatusOK, gin.H{
+		"factor":               factor,
+		"sold_months":          catalogSoldMonths,
+		"skipped_no_lead_time": skipped,
+		"sizes":                sizes,
+	})
+}
+
+// leadTimeValue reads lead_time, which the metrics table may hold as a
+// number or a numeric string.
+func leadTimeValue(value interface{}) (float64, bool) {
+	if days, ok := numericValue(value); ok {
+		return days, days > 0
+	}
+	if s, ok := value.(string); ok {
+		days, err := strconv.ParseFloat(s, 64)
+		return days, err == nil && days > 0
+	}
+	return 0, false
+}
+
+func checkOverstock(row map[string]interface{}, windowDays, leadTimeDays, factor float64) (sizeOverstockRisk, bool) {
+	available, _ := numericValue(row["available_count"])
+	purchased, _ := numericValue(row["purchased_count"])
+	sold, _ := numericValue(row["sold_last_24_months"])
+	if purchased <= 0 {
+		return sizeOverstockRisk{}, false
+	}
+
+	dailyDemand := sold / windowDays
+	projected := dailyDemand * leadTimeDays
+	supply := available + purchased
+	if supply <= factor*projected {
+		return sizeOverstockRisk{}, false
+	}
+
+	sku, _ := row["sku"].(string)
+	size, _ := row["size"].(string)
+	risk := sizeOverstockRisk{
+		Sku:             sku,
+		Size:            normalizeSize(size),
+		AvailableCount:  available,
+		PurchasedCount:  purchased,
+		Supply:          supply,
+		DailyDemand:     math.Round(dailyDemand*1000) / 1000,
+		LeadTimeDays:    leadTimeDays,
+		ProjectedDemand: math.Round(projected*100) / 100,
+		ExcessUnits:     math.Round((supply-projected)*100) / 100,
+	}
+	if projected > 0 {
+		ratio := math.Round(supply/projected*100) / 100
+		risk.SupplyToDemand = &ratio
+	}
+	return risk, true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+)
+
+const maxPageSize = 10000
+
+// pagination is the optional limit/offset window requested via ?limit= and
+// ?offset=. A zero Limit means the client did not ask for paging and gets the
+// full result set, which is what every endpoint returned before paging existed.
+type pagination struct {
+	Limit  int
+	Offset int
+}
+
+// parsePagination reads ?limit= and ?offset=, recording any problems in v.
+func parsePagination(c *gin.Context, v *validator) pagination {
+	var p pagination
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			v.add("limit", fmt.Sprintf("limit must be an integer between 1 and %d", maxPageSize))
+		} else {
+			p.Limit = limit
+		}
+	}
+
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			v.add("offset", "offset must be a non-negative integer")
+		} else {
+			p.Offset = offset
+		}
+	}
+
+	return p
+}
+
+// clause returns the LIMIT/OFFSET suffix for a query, or an empty string when
+// no paging was requested. The values are bound via parameters().
+func (p pagination) clause() string {
+	if p.Limit == 0 {
+		return ""
+	}
+	return "LIMIT @limit OFFSET @offset"
+}
+
+func (p pagination) parameters() []bigquery.QueryParameter {
+	if p.Limit == 0 {
+		return nil
+	}
+	return []bigquery.QueryParameter{
+		{Name: "limit", Value: p.Limit},
+		{Name: "offset", Value: p.Offset},
+	}
+}
+
+// slice applies the window to rows that were already loaded, for endpoints
+// that page over a cached result rather than in SQL.
+func (p pagination) slice(rows []map[string]interface{}) []map[string]interface{} {
+	if p.Limit == 0 {
+		return rows
+	}
+	if p.Offset >= len(rows) {
+		return []map[string]interface{}{}
+	}
+	end := p.Offset + p.Limit
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[p.Offset:end]
+}
+
+// setLinkHeader sets an RFC 5988 Link header with the first, prev, next and
+// last pages, keeping the request's other query parameters. count is the
+// number of rows on this page and total the unpaged count, or -1 if unknown,
+// in which case last is left out and next is given while pages are full.
+func (p pagination) setLinkHeader(c *gin.Context, count, total int) {
+	if p.Limit == 0 {
+		return
+	}
+
+	base := requestBaseURL(c) + c.Request.URL.Path
+	link := func(offset int, rel string) string {
+		query := c.Request.URL.Query()
+		query.Set("limit", strconv.Itoa(p.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, base, query.Encode(), rel)
+	}
+
+	links := []string{link(0, "first")}
+	if p.Offset > 0 {
+		links = append(links, link(max(p.Offset-p.Limit, 0), "prev"))
+	}
+	if total >= 0 {
+		if p.Offset+p.Limit < total {
+			links = append(links, link(p.Offset+p.Limit, "next"))
+		}
+		lastOffset := 0
+		if total > 0 {
+			lastOffset = (total - 1) / p.Limit * p.Limit
+		}
+		links = append(links, link(lastOffset, "last"))
+	} else if count == p.Limit {
+		links = append(links, link(p.Offset+p.Limit, "next"))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+}
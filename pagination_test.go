@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var nextLinkPattern = regexp.MustCompile(`<([^>]*)>; rel="next"`)
+
+// nextOffset returns the offset of the next link setLinkHeader sets for
+// page, or -1 if there is none.
+func nextOffset(t *testing.T, page pagination, count, total int) int {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/purchase-orders?limit="+strconv.Itoa(page.Limit), nil)
+	page.setLinkHeader(c, count, total)
+
+	match := nextLinkPattern.FindStringSubmatch(c.Writer.Header().Get("Link"))
+	if match == nil {
+		return -1
+	}
+	next, err := url.Parse(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := strconv.Atoi(next.Query().Get("offset"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return offset
+}
+
+// TestPaginationFollowsNextLinks pages through result sets by following the
+// next links, with and without a known total, and checks every row is seen
+// exactly once.
+func TestPaginationFollowsNextLinks(t *testing.T) {
+	for _, size := range []int{0, 1, 9, 10, 11, 25} {
+		rows := make([]map[string]interface{}, size)
+		for i := range rows {
+			rows[i] = map[string]interface{}{"row": i}
+		}
+		for _, limit := range []int{1, 3, 10, 50} {
+			for _, total := range []int{size, -1} {
+				seen := make([]int, size)
+				page := pagination{Limit: limit}
+				for pages := 0; ; pages++ {
+					if pages > size+1 {
+						t.Fatalf("size %d, limit %d, total %d: next links don't terminate", size, limit, total)
+					}
+					rowsOnPage := page.slice(rows)
+					for _, row := range rowsOnPage {
+						seen[row["row"].(int)]++
+					}
+					next := nextOffset(t, page, len(rowsOnPage), total)
+					if next < 0 {
+						break
+					}
+					if next != page.Offset+limit {
+						t.Fatalf("size %d, limit %d: next offset %d after offset %d", size, limit, next, page.Offset)
+					}
+					page.Offset = next
+				}
+				for i, count := range seen {
+					if count != 1 {
+						t.Errorf("size %d, limit %d, total %d: row %d seen %d times", size, limit, total, i, count)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPaginationSlice(t *testing.T) {
+	rows := make([]map[string]interface{}, 5)
+	tests := []struct {
+		page pagination
+		want int
+	}{
+		{pagination{}, 5},
+		{pagination{Limit: 2}, 2},
+		{pagination{Limit: 2, Offset: 4}, 1},
+		{pagination{Limit: 2, Offset: 5}, 0},
+		{pagination{Limit: 2, Offset: 9}, 0},
+	}
+	for _, tt := range tests {
+		if got := len(tt.page.slice(rows)); got != tt.want {
+			t.Errorf("%+v: got %d rows, want %d", tt.page, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	problemContentType = "application/problem+json"
+
+	// problemTypePrefix starts every problem type URI. The types are
+	// identifiers rather than documentation links.
+	problemTypePrefix = "urn:etiql:problem:"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// problemWriter holds back JSON error bodies so problemJSONMiddleware can
+// rewrite them once the handler chain is done. Everything else passes
+// straight through.
+type problemWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	captured bool
+}
+
+func (w *problemWriter) capture() bool {
+	if w.captured {
+		return true
+	}
+	if w.ResponseWriter.Written() || w.Status() < http.StatusBadRequest {
+		return false
+	}
+	w.captured = strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	return w.captured
+}
+
+func (w *problemWriter) Write(data []byte) (int, error) {
+	if w.capture() {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *problemWriter) WriteString(s string) (int, error) {
+	if w.capture() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// problemJSONMiddleware returns errors as RFC 7807 problem details to clients
+// that send Accept: application/problem+json; everyone else keeps the usual
+// {"error": ...} body. It must run before any middleware that can fail a
+// request.
+func problemJSONMiddleware(c *gin.Context) {
+	if !strings.Contains(c.GetHeader("Accept"), problemContentType) {
+		c.Next()
+		return
+	}
+
+	writer := &problemWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	if !writer.captured {
+		return
+	}
+	body, err := marshalJSON(problemDetails(c, writer.Status(), writer.body.Bytes()))
+	if err != nil {
+		// Fall back to the original body rather than lose the error
+		writer.ResponseWriter.Write(writer.body.Bytes())
+		return
+	}
+	writer.Header().Set("Content-Type", problemContentType)
+	writer.Header().Del("Content-Length")
+	writer.ResponseWriter.Write(body)
+}
+
+// problemDetails maps one of our error bodies to a problem: error becomes
+// title, message (or details, when it is a string) becomes detail, and the
+// type is derived from code, or from error for responses without one, e.g.
+// QUERY_CAPACITY becomes urn:etiql:problem:query-capacity. Any other fields
+// are kept as extension members.
+func problemDetails(c *gin.Context, status int, body []byte) map[string]interface{} {
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		fields = map[string]interface{}{}
+	}
+
+	problem := make(map[string]interface{}, len(fields)+4)
+	for key, value := range fields {
+		problem[key] = value
+	}
+
+	title, _ := fields["error"].(string)
+	if title == "" {
+		title = http.StatusText(status)
+	}
+	delete(problem, "error")
+	problem["title"] = title
+
+	slug := title
+	if code, ok := fields["code"].(string); ok && code != "" {
+		slug = code
+	}
+	slug = strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(slug), "-"), "-")
+	if slug == "" {
+		slug = strconv.Itoa(status)
+	}
+	problem["type"] = problemTypePrefix + slug
+
+	if message, ok := fields["message"].(string); ok {
+		delete(problem, "message")
+		problem["detail"] = message
+	} else if details, ok := fields["details"].(string); ok {
+		delete(problem, "details")
+		problem["detail"] = details
+	}
+
+	problem["status"] = status
+	// The path only: export links carry the token in the query string
+	problem["instance"] = c.Request.URL.Path
+	return problem
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var defaultPublicPaths = []string{"/", "/healthz"}
+
+// publicPaths are served without a bearer token. An entry ending in "*"
+// matches every path with that prefix, e.g. "/reference/*".
+var publicPaths = defaultPublicPaths
+
+// loadPublicPaths reads PUBLIC_PATHS (comma-separated) at startup and panics
+// on a malformed list so a bad deploy fails immediately. Setting it replaces
+// the defaults, so include / and /healthz if they should stay public.
+func loadPublicPaths() {
+	value := os.Getenv("PUBLIC_PATHS")
+	if value == "" {
+		fmt.Printf("Public paths: %s\n", strings.Join(publicPaths, ", "))
+		return
+	}
+
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if !strings.HasPrefix(path, "/") {
+			panic(fmt.Sprintf("Invalid PUBLIC_PATHS: %q must start with /", path))
+		}
+		paths = append(paths, path)
+	}
+
+	publicPaths = paths
+	fmt.Printf("Public paths: %s\n", strings.Join(paths, ", "))
+}
+
+// isPublicPath reports whether path may be requested without a token.
+func isPublicPath(path string) bool {
+	for _, public := range publicPaths {
+		if prefix, ok := strings.CutSuffix(public, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == public {
+			return true
+		}
+	}
+	return false
+}
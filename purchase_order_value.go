@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// getPurchaseOrderValueByMonth serves GET /purchase-orders/value-by-month:
+// the value of incoming purchase orders (quantity * purchase_price from the
+// metrics table) grouped by delivery month. Values are raw FLOAT64 amounts
+// in the currency of purchase_price, not formatted, so clients can sum and
+// format them as they need. unpriced_quantity counts units whose product has
+// no purchase_price and are therefore missing from value. Placeholder items
+// are skipped unless ?include_placeholder_items=true, ?warehouse= limits
+// the totals to products stocked in one warehouse, and
+// ?delivery_from=/?delivery_to= to a delivery date window.
+func getPurchaseOrderValueByMonth(c *gin.Context) {
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Purchase order value by month requested")
+
+	var v validator
+	filters := purchaseOrderFilters(c, &v, "PURCHASE_ORDER_VALUE_MAX_DELIVERY_WINDOW_MONTHS")
+	if v.respond(c) {
+		return
+	}
+
+	query, err := newQuery(`
+		WITH prices AS (
+		  SELECT product_id, ANY_VALUE(purchase_price) AS purchase_price
+		  FROM metal-force-400307.agent.sku_sizes_metrics
+		  WHERE product_id IS NOT NULL
+		  GROUP BY product_id
+		)
+		SELECT
+			FORMAT_DATE('%Y-%m', SAFE_CAST(po.delivery_date AS DATE)) AS delivery_month,
+			COUNT(DISTINCT po.id) AS purchase_orders,
+			SUM(items.quantity) AS quantity,
+			ROUND(SUM(items.quantity * prices.purchase_price), 2) AS value,
+			SUM(IF(prices.purchase_price IS NULL, items.quantity, 0)) AS unpriced_quantity
+		FROM metal-force-400307.agent.purchase_orders po,
+		UNNEST(po.items) AS items
+		LEFT JOIN prices ON prices.product_id = items.product_id
+		WHERE po.delivery_date >= FORMAT_DATE('%Y-%m-%d', CURRENT_DATE())
+		  AND (items.product_id != 0 OR @include_placeholder_items)
+		  AND (@warehouse = '' OR items.product_id IN (` + warehouseProductsSQL + `))
+		  AND (@delivery_from = '' OR po.delivery_date >= @delivery_from)
+		  AND (@delivery_to = '' OR po.delivery_date <= @delivery_to)
+		GROUP BY delivery_month
+		ORDER BY delivery_month
+	`)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	query.Parameters = filters
+
+	queryStart := time.Now()
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	var results []map[string]interface{}
+	for {
+		var values []bigquery.Value
+		err := it.Next(&values)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+
+		row := make(map[string]interface{})
+		for i, field := range it.Schema {
+			if i < len(values) {
+				row[field.Name] = convertValue(field, values[i])
+			}
+		}
+		results = append(results, row)
+	}
+
+	c.Set(queryTimeKey, time.Since(queryStart))
+	loggerFrom(ctx).Info("Returning purchase order value", "months", len(results))
+	c.Header("Cache-Control", "private, max-age=300")
+	respondRows(c, http.StatusOK, it.Schema, results)
+}
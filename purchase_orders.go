@@ -4,18 +4,105 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
 )
 
 
-
+// getPurchaseOrders returns upcoming purchase order items, one row per item.
+// Like /all-purchase-orders it skips placeholder items (product_id 0) unless
+// ?include_placeholder_items=true, so both report the same item counts.
+// ?warehouse= limits the items to products stocked in one warehouse,
+// ?delivery_from=/?delivery_to= to a delivery date window, and
+// ?limit=/?offset= page through the result.
 func getPurchaseOrders(c *gin.Context) {
-	fmt.Println("Purchase orders requested")
-	ctx := context.Background()
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Purchase orders requested")
+
+	var v validator
+	filters := purchaseOrderFilters(c, &v, "PURCHASE_ORDERS_MAX_DELIVERY_WINDOW_MONTHS")
+	page := parsePagination(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	queryStart := time.Now()
+	results, err := queryPurchaseOrderItems(ctx, "", filters, page)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
 
-	query := bqClient.Query(`
+	c.Set(queryTimeKey, time.Since(queryStart))
+	loggerFrom(ctx).Info("Returning purchase order items", "rows", len(results.Rows))
+	page.setLinkHeader(c, len(results.Rows), -1)
+	c.Header("Cache-Control", "private, max-age=300")
+	respondRows(c, http.StatusOK, results.Schema, results.Rows)
+}
+
+const defaultMaxDeliveryWindowMonths = 36
+
+// maxDeliveryWindowMonths is the widest ?delivery_from=/?delivery_to= window
+// an endpoint accepts: envVar if set, else MAX_DELIVERY_WINDOW_MONTHS
+// (default 36). Like maxSoldMonths it keeps a client from asking for a
+// ten-year range; a window with an open end is the endpoint's default range
+// and isn't capped.
+func maxDeliveryWindowMonths(envVar string) int {
+	return envInt(envVar, envInt("MAX_DELIVERY_WINDOW_MONTHS", defaultMaxDeliveryWindowMonths))
+}
+
+// purchaseOrderFilters binds the ?include_placeholder_items=, ?warehouse=,
+// ?delivery_from= and ?delivery_to= filters shared by the purchase-order
+// queries, recording invalid dates and windows wider than
+// maxDeliveryWindowMonths(limitEnvVar) in v.
+func purchaseOrderFilters(c *gin.Context, v *validator, limitEnvVar string) []bigquery.QueryParameter {
+	from := deliveryDateParameter(c, v, "delivery_from")
+	to := deliveryDateParameter(c, v, "delivery_to")
+	if from.Value != "" && to.Value != "" {
+		fromDate, _ := civil.ParseDate(from.Value.(string))
+		toDate, _ := civil.ParseDate(to.Value.(string))
+		limit := maxDeliveryWindowMonths(limitEnvVar)
+		if toDate.Before(fromDate) {
+			v.add("delivery_to", "delivery_to must not be before delivery_from")
+		} else if fromDate.In(time.UTC).AddDate(0, limit, 0).Before(toDate.In(time.UTC)) {
+			v.add("delivery_to", fmt.Sprintf("delivery_to must be at most %d months after delivery_from", limit))
+		}
+	}
+	return []bigquery.QueryParameter{
+		placeholderItemsParameter(includePlaceholderItems(c)),
+		warehouseParameter(c),
+		from,
+		to,
+	}
+}
+
+// deliveryDateParameter binds one end of the delivery date window, an
+// inclusive YYYY-MM-DD date. An empty value leaves that end open. delivery_date
+// is stored as a YYYY-MM-DD string, so the bound compares as a string.
+func deliveryDateParameter(c *gin.Context, v *validator, name string) bigquery.QueryParameter {
+	value := c.Query(name)
+	if value != "" {
+		date, err := civil.ParseDate(value)
+		if err != nil {
+			v.add(name, name+" must be a date in YYYY-MM-DD format")
+			value = ""
+		} else {
+			value = date.String()
+		}
+	}
+	return bigquery.QueryParameter{Name: name, Value: value}
+}
+
+// purchaseOrderItemsSQL selects upcoming purchase order items, restricted to
+// @sku_id unless it is empty. Base SKUs are the first 9 characters of the
+// item SKU, as in the open_orders CTE. The order is total, down to the
+// item's position in its PO, so offset pages never skip or repeat an item.
+func purchaseOrderItemsSQL(page pagination) string {
+	return `
 		SELECT 
 			id,
 			delivery_date,
@@ -24,43 +111,52 @@ func getPurchaseOrders(c *gin.Context) {
 			items.size,
 			items.quantity
 		FROM metal-force-400307.agent.purchase_orders,
-		UNNEST(items) as items
+		UNNEST(items) as items WITH OFFSET AS item_index
 		WHERE delivery_date >= FORMAT_DATE('%Y-%m-%d', CURRENT_DATE())
-		ORDER BY delivery_date, id, items.product_id
-	`)
+		  AND (items.product_id != 0 OR @include_placeholder_items)
+		  AND (@warehouse = '' OR items.product_id IN (` + warehouseProductsSQL + `))
+		  AND (@delivery_from = '' OR delivery_date >= @delivery_from)
+		  AND (@delivery_to = '' OR delivery_date <= @delivery_to)
+		  AND (@sku_id = '' OR SUBSTRING(items.sku, 1, 9) = @sku_id)
+		ORDER BY delivery_date, id, items.product_id, item_index
+		` + page.clause()
+}
 
-	it, err := query.Read(ctx)
+// queryPurchaseOrderItems returns upcoming purchase order items, restricted
+// to one base SKU unless skuId is empty, in purchaseOrderItemsSQL order.
+func queryPurchaseOrderItems(ctx context.Context, skuId string, filters []bigquery.QueryParameter, page pagination) (rowSet, error) {
+	query, err := newQuery(purchaseOrderItemsSQL(page))
 	if err != nil {
-		fmt.Printf("BigQuery error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to query BigQuery",
-			"details": err.Error(),
-		})
-		return
+		return rowSet{}, err
+	}
+	query.Parameters = append([]bigquery.QueryParameter{{Name: "sku_id", Value: skuId}}, filters...)
+	query.Parameters = append(query.Parameters, page.parameters()...)
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return rowSet{}, err
 	}
 
 	var results []map[string]interface{}
-	rowCount := 0
 	for {
 		var values []bigquery.Value
 		err := it.Next(&values)
-		if err != nil {
+		if err == iterator.Done {
 			break
 		}
-		rowCount++
-		
+		if err != nil {
+			return rowSet{}, err
+		}
+
 		// Convert to map using schema
 		row := make(map[string]interface{})
-		schema := it.Schema
-		for i, field := range schema {
+		for i, field := range it.Schema {
 			if i < len(values) {
-				row[field.Name] = values[i]
+				row[field.Name] = convertValue(field, values[i])
 			}
 		}
 		results = append(results, row)
 	}
 
-	fmt.Printf("Returning %d purchase order items\n", len(results))
-	c.Header("Cache-Control", "private, max-age=300")
-	c.JSON(http.StatusOK, results)
-} 
\ No newline at end of file
+	return rowSet{Schema: it.Schema, Rows: results}, nil
+}
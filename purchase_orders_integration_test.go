@@ -0,0 +1,77 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// TestIntegrationPurchaseOrderItemCounts checks that /purchase-orders and
+// /all-purchase-orders report the same number of items for every upcoming
+// purchase order, with and without placeholder items.
+func TestIntegrationPurchaseOrderItemCounts(t *testing.T) {
+	integrationClient(t)
+	ctx := context.Background()
+
+	for _, target := range []string{"/", "/?include_placeholder_items=true"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		var v validator
+		filters := purchaseOrderFilters(c, &v, "PURCHASE_ORDERS_MAX_DELIVERY_WINDOW_MONTHS")
+
+		items, err := queryPurchaseOrderItems(ctx, "", filters, pagination{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		flattened := map[string]int64{}
+		for _, row := range items.Rows {
+			flattened[fmt.Sprint(row["id"])]++
+		}
+
+		query, err := newQuery(allPurchaseOrdersCTE + `
+			SELECT CAST(id AS STRING) AS id, ARRAY_LENGTH(items) AS item_count
+			FROM filtered_items
+			WHERE ARRAY_LENGTH(items) > 0
+			  AND delivery_date >= FORMAT_DATE('%Y-%m-%d', CURRENT_DATE())
+		`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query.Parameters = filters
+		it, err := readQuery(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nested := map[string]int64{}
+		for {
+			var row struct {
+				ID        string `bigquery:"id"`
+				ItemCount int64  `bigquery:"item_count"`
+			}
+			err := it.Next(&row)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			nested[row.ID] = row.ItemCount
+		}
+
+		if len(flattened) != len(nested) {
+			t.Errorf("%s: %d purchase orders flattened, %d nested", target, len(flattened), len(nested))
+		}
+		for id, count := range nested {
+			if flattened[id] != count {
+				t.Errorf("%s: purchase order %s has %d items nested but %d flattened", target, id, count, flattened[id])
+			}
+		}
+	}
+}
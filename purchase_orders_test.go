@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	orderByPattern       = regexp.MustCompile(`ORDER BY ([^\n]+)\n\s*LIMIT @limit OFFSET @offset`)
+	placeholderPredicate = regexp.MustCompile(`(items\.)?product_id != 0 OR @include_placeholder_items`)
+)
+
+// TestPurchaseOrderItemsTotalOrder checks that the item query orders by a
+// unique key before paging. id identifies the purchase order and item_index
+// the item's position in it, so the order must end with both for offset pages
+// to neither skip nor repeat items that tie on delivery_date.
+func TestPurchaseOrderItemsTotalOrder(t *testing.T) {
+	sql := purchaseOrderItemsSQL(pagination{Limit: 10})
+	match := orderByPattern.FindStringSubmatch(sql)
+	if match == nil {
+		t.Fatalf("no ORDER BY directly before LIMIT in:\n%s", sql)
+	}
+	keys := strings.Split(match[1], ", ")
+	if keys[0] != "delivery_date" {
+		t.Errorf("items should be ordered by delivery_date first, got %v", keys)
+	}
+	if !slices.Contains(keys, "id") || keys[len(keys)-1] != "item_index" {
+		t.Errorf("order %v is not total: it needs id and must end with item_index", keys)
+	}
+
+	if sql := purchaseOrderItemsSQL(pagination{}); strings.Contains(sql, "LIMIT") {
+		t.Errorf("unpaged query has a LIMIT:\n%s", sql)
+	}
+}
+
+// TestPurchaseOrderItemsPagesWithTies pages through items that tie on every
+// key but item_index, sorted like the query, starting from different input
+// orders, and checks each page boundary lands on the same items.
+func TestPurchaseOrderItemsPagesWithTies(t *testing.T) {
+	type item struct {
+		deliveryDate string
+		id           int
+		productID    int
+		itemIndex    int
+	}
+	var items []item
+	for id := 1; id <= 3; id++ {
+		for index := 0; index < 4; index++ {
+			// two product ids per order, so product_id ties as well
+			items = append(items, item{"2026-11-01", id, 100 + index%2, index})
+		}
+	}
+	less := func(a, b item) bool {
+		if a.deliveryDate != b.deliveryDate {
+			return a.deliveryDate < b.deliveryDate
+		}
+		if a.id != b.id {
+			return a.id < b.id
+		}
+		if a.productID != b.productID {
+			return a.productID < b.productID
+		}
+		return a.itemIndex < b.itemIndex
+	}
+
+	var pages []string
+	for run := 0; run < 2; run++ {
+		shuffled := append([]item(nil), items...)
+		if run == 1 {
+			for i, j := 0, len(shuffled)-1; i < j; i, j = i+1, j-1 {
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			}
+		}
+		sort.Slice(shuffled, func(i, j int) bool { return less(shuffled[i], shuffled[j]) })
+
+		rows := make([]map[string]interface{}, len(shuffled))
+		for i, it := range shuffled {
+			rows[i] = map[string]interface{}{"key": fmt.Sprintf("%d/%d", it.id, it.itemIndex)}
+		}
+		seen := map[string]bool{}
+		var keys []string
+		for page := (pagination{Limit: 5}); page.Offset < len(rows); page.Offset += page.Limit {
+			for _, row := range page.slice(rows) {
+				key := row["key"].(string)
+				if seen[key] {
+					t.Fatalf("item %s repeated at offset %d", key, page.Offset)
+				}
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if len(seen) != len(items) {
+			t.Fatalf("paged %d of %d items", len(seen), len(items))
+		}
+		pages = append(pages, strings.Join(keys, ","))
+	}
+	if pages[0] != pages[1] {
+		t.Errorf("page contents depend on the input order:\n%s\n%s", pages[0], pages[1])
+	}
+}
+
+// TestPurchaseOrderQueriesShareItemFilters checks /purchase-orders and
+// /all-purchase-orders drop the same items: both bind every filter from
+// purchaseOrderFilters and apply the same placeholder predicate, so they
+// agree on the item count of each purchase order. The integration test
+// TestIntegrationPurchaseOrderItemCounts compares the counts on live data.
+func TestPurchaseOrderQueriesShareItemFilters(t *testing.T) {
+	for _, target := range []string{"/", "/?include_placeholder_items=true&delivery_from=2026-01-01&delivery_to=2026-12-31"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		var v validator
+		filters := purchaseOrderFilters(c, &v, "PURCHASE_ORDERS_MAX_DELIVERY_WINDOW_MONTHS")
+		if len(v.errors) > 0 {
+			t.Fatalf("%s: %v", target, v.errors)
+		}
+
+		queries := map[string]string{
+			"/purchase-orders":     purchaseOrderItemsSQL(pagination{}),
+			"/all-purchase-orders": allPurchaseOrdersCTE,
+		}
+		for route, sql := range queries {
+			for _, param := range filters {
+				if !strings.Contains(sql, "@"+param.Name) {
+					t.Errorf("%s doesn't apply the %s filter", route, param.Name)
+				}
+			}
+			if !placeholderPredicate.MatchString(sql) {
+				t.Errorf("%s doesn't skip placeholder items with product_id != 0 OR @include_placeholder_items", route)
+			}
+		}
+	}
+}
+
+// TestPurchaseOrderFiltersDeliveryWindow checks the delivery window cap, its
+// per-endpoint override and that a window with an open end isn't capped.
+func TestPurchaseOrderFiltersDeliveryWindow(t *testing.T) {
+	t.Setenv("MAX_DELIVERY_WINDOW_MONTHS", "")
+	t.Setenv("TEST_MAX_DELIVERY_WINDOW_MONTHS", "")
+	tests := []struct {
+		query    string
+		override string
+		valid    bool
+	}{
+		{"delivery_from=2026-01-01&delivery_to=2028-12-31", "", true},
+		{"delivery_from=2026-01-01&delivery_to=2029-01-01", "", true},
+		{"delivery_from=2026-01-01&delivery_to=2029-01-02", "", false},
+		{"delivery_from=2026-01-01&delivery_to=2036-01-01", "", false},
+		{"delivery_from=2026-01-01&delivery_to=2026-07-02", "6", false},
+		{"delivery_from=2026-01-01&delivery_to=2030-01-01", "48", true},
+		{"delivery_from=2026-01-01", "1", true},
+		{"delivery_to=2036-01-01", "1", true},
+		{"delivery_from=2026-02-01&delivery_to=2026-01-01", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_MAX_DELIVERY_WINDOW_MONTHS", tt.override)
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+		var v validator
+		purchaseOrderFilters(c, &v, "TEST_MAX_DELIVERY_WINDOW_MONTHS")
+		if valid := len(v.errors) == 0; valid != tt.valid {
+			t.Errorf("%s (limit %q): valid = %t, want %t (%v)", tt.query, tt.override, valid, tt.valid, v.errors)
+		}
+	}
+}
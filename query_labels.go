@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// maxLabelValueLength is BigQuery's limit on a label value.
+const maxLabelValueLength = 63
+
+// labelUnsafe matches runs of characters BigQuery doesn't allow in a label
+// value.
+var labelUnsafe = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// labelValue makes s usable as a label value: lowercased, with disallowed
+// characters collapsed to "_" and cut to 63 characters. An empty result
+// becomes fallback.
+func labelValue(s, fallback string) string {
+	value := labelUnsafe.ReplaceAllString(strings.ToLower(s), "_")
+	value = strings.Trim(value, "_")
+	if len(value) > maxLabelValueLength {
+		value = value[:maxLabelValueLength]
+	}
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// applyQueryLabels tags the query's job with the requesting token's alias
+// and the route it serves, e.g. client:frontend and
+// endpoint:sku-metrics_sku_id for /sku-metrics/:sku_id, so billing exports
+// can attribute cost per client and endpoint. Requests without a token are
+// labelled client:anonymous.
+func applyQueryLabels(ctx context.Context, query *bigquery.Query) {
+	info := requestInfoFrom(ctx)
+	if query.Labels == nil {
+		query.Labels = map[string]string{}
+	}
+	query.Labels["client"] = labelValue(info.Client, "anonymous")
+	query.Labels["endpoint"] = labelValue(info.Route, "none")
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/sku-metrics/:sku_id", "sku-metrics_sku_id"},
+		{"/purchase-orders", "purchase-orders"},
+		{"Frontend App", "frontend_app"},
+		{"", "none"},
+		{"/", "none"},
+		{strings.Repeat("a", 70), strings.Repeat("a", maxLabelValueLength)},
+	}
+	for _, tt := range tests {
+		if got := labelValue(tt.in, "none"); got != tt.want {
+			t.Errorf("labelValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
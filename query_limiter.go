@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// warmupTick is how often a waiting query rechecks the limit while it
+	// ramps.
+	warmupTick = 100 * time.Millisecond
+
+	defaultQuerySlotWait           = 10 * time.Second
+	defaultQueryCapacityRetryAfter = 5
+)
+
+// errQueryCapacity is returned when a query waited QUERY_SLOT_WAIT_TIMEOUT
+// for a slot without getting one. respondQueryError turns it into a 503.
+var errQueryCapacity = errors.New("all BigQuery query slots are busy")
+
+// queryLimiter caps how many BigQuery queries run at once. For the first
+// QUERY_WARMUP_SECONDS after startup the cap ramps linearly from
+// QUERY_WARMUP_START_LIMIT up to BIGQUERY_MAX_CONCURRENT_QUERIES, so the
+// burst of cache misses after a deploy reaches BigQuery gradually rather
+// than all at once.
+type queryLimiter struct {
+	mu       sync.Mutex
+	inFlight int
+	wake     chan struct{}
+
+	max        int
+	startLimit int
+	started    time.Time
+	warmup     time.Duration
+	maxWait    time.Duration
+}
+
+var queryConcurrency *queryLimiter
+
+// newQueryLimiter reads the limiter config at startup. With
+// BIGQUERY_MAX_CONCURRENT_QUERIES unset it returns nil, which doesn't limit.
+func newQueryLimiter() *queryLimiter {
+	max := envInt("BIGQUERY_MAX_CONCURRENT_QUERIES", 0)
+	warmup := envDuration("QUERY_WARMUP_SECONDS", 0)
+	if max == 0 {
+		if warmup > 0 {
+			fmt.Println("WARNING: QUERY_WARMUP_SECONDS needs BIGQUERY_MAX_CONCURRENT_QUERIES, ignoring it")
+		}
+		return nil
+	}
+
+	startLimit := envInt("QUERY_WARMUP_START_LIMIT", 1)
+	if startLimit > max {
+		startLimit = max
+	}
+	fmt.Printf("Query concurrency: %d, ramping from %d over %s\n", max, startLimit, warmup)
+	return &queryLimiter{
+		wake:       make(chan struct{}),
+		max:        max,
+		startLimit: startLimit,
+		started:    time.Now(),
+		warmup:     warmup,
+		maxWait:    envDuration("QUERY_SLOT_WAIT_TIMEOUT", defaultQuerySlotWait),
+	}
+}
+
+// limit is the cap at now, somewhere between startLimit and max during the
+// warmup.
+func (l *queryLimiter) limit(now time.Time) int {
+	elapsed := now.Sub(l.started)
+	if l.warmup <= 0 || elapsed >= l.warmup {
+		return l.max
+	}
+	return l.startLimit + int(float64(l.max-l.startLimit)*elapsed.Seconds()/l.warmup.Seconds())
+}
+
+// warmingUp reports whether the cap is still ramping.
+func (l *queryLimiter) warmingUp() bool {
+	return l != nil && l.limit(time.Now()) < l.max
+}
+
+// acquire waits for a query slot, giving up with errQueryCapacity after
+// QUERY_SLOT_WAIT_TIMEOUT seconds (default 10) or when ctx ends.
+func (l *queryLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	timeout := time.NewTimer(l.maxWait)
+	defer timeout.Stop()
+	for {
+		l.mu.Lock()
+		if l.inFlight < l.limit(time.Now()) {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		// While warming up the limit grows on its own, so recheck
+		// periodically rather than only when a slot frees up
+		var tick <-chan time.Time
+		if l.warmingUp() {
+			tick = time.After(warmupTick)
+		}
+		select {
+		case <-wake:
+		case <-tick:
+		case <-timeout.C:
+			l.mu.Lock()
+			inFlight := l.inFlight
+			l.mu.Unlock()
+			loggerFrom(ctx).Warn("No BigQuery query slot available", "in_flight", inFlight, "limit", l.limit(time.Now()), "waited", l.maxWait)
+			return errQueryCapacity
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *queryLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryTokenAllowed reports whether the request may authenticate with
+// ?token= instead of an Authorization header. This exists for CSV export
+// links sent by email, which a browser opens without custom headers.
+//
+// Tokens in URLs end up in browser history, proxy logs and Referer headers,
+// so this is off unless ALLOW_QUERY_TOKEN=true, and then only for GET CSV
+// exports. The Authorization header remains the primary mechanism and always
+// takes precedence.
+func queryTokenAllowed(c *gin.Context) bool {
+	return os.Getenv("ALLOW_QUERY_TOKEN") == "true" &&
+		c.Request.Method == http.MethodGet &&
+		c.Query("format") == "csv" &&
+		c.Query("token") != ""
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxQueryStringLength = 2048
+	defaultMaxQueryValueLength  = 256
+)
+
+// commonQueryParams are accepted on every route; they are handled by shared
+// middleware or by respondRows.
+var commonQueryParams = []string{"format", "bom", "delimiter", "decimal", "transform", "omitempty", "explain_sql", "token", "nocache", "refresh"}
+
+// routeQueryParams lists the parameters each route understands on top of
+// commonQueryParams. Routes missing from the map skip the allow-list check,
+// so new handlers need an entry here to get it.
+var routeQueryParams = map[string][]string{
+	"/":                                  nil,
+	"/healthz":                           nil,
+	"/ping":                              nil,
+	"/metrics":                           nil,
+	"/batch":                             nil,
+	"/jobs":                              nil,
+	"/jobs/:id":                          nil,
+	"/purchase-orders":                   {"include_placeholder_items", "warehouse", "delivery_from", "delivery_to", "limit", "offset"},
+	"/purchase-orders/value-by-month":    {"include_placeholder_items", "warehouse", "delivery_from", "delivery_to"},
+	"/inventory/value":                   {"category", "season", "group_by"},
+	"/inventory/snapshot-date":           nil,
+	"/dashboard":                         nil,
+	"/all-purchase-orders":               {"limit", "offset", "include_totals", "include_placeholder_items", "warehouse", "delivery_from", "delivery_to"},
+	"/sku-metrics":                       {"list", "sort", "order", "limit", "offset"},
+	"/sku-metrics/mto":                   {"list", "limit", "offset"},
+	"/sku-metrics/fingerprint":           {"list"},
+	"/sku-metrics/overstock-risk":        {"list", "factor", "lead_time_days", "limit", "offset"},
+	"/sku-metrics/cluster/:cluster":      {"group_by", "limit", "offset"},
+	"/sku-metrics/:sku_id":               {"size", "by_warehouse", "sold_months", "include", "include_placeholder_items", "warehouse", "delivery_from", "delivery_to", "raw_sizes", "monthly", "layout"},
+	"/sku-metrics/:sku_id/stockout-risk": {"sold_months", "lead_time_days", "min_risk"},
+	"/sku-metrics/:sku_id/gap":           nil,
+	"/sku-metrics/:sku_id/missing-sizes": {"sizes"},
+	"/skus/:sku_id/exists":               nil,
+	"/skus/search":                       {"prefix", "limit"},
+	"/exports":                           nil,
+	"/exports/:id":                       nil,
+	"/sku-lists":                         {"name"},
+	"/admin/warm/:sku_id":                {"sold_months"},
+	"/admin/jobs":                        nil,
+}
+
+func envInt(envVar string, def int) int {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		fmt.Printf("WARNING: Ignoring invalid %s: %s\n", envVar, value)
+		return def
+	}
+	return n
+}
+
+// queryValidationMiddleware rejects malformed query strings with a 400 before
+// they reach a handler: a query string longer than MAX_QUERY_STRING_LENGTH,
+// a value longer than MAX_QUERY_VALUE_LENGTH, or a parameter repeated with
+// different values. Parameters a route doesn't know are logged, or rejected
+// with QUERY_PARAMS_STRICT=true.
+func queryValidationMiddleware() gin.HandlerFunc {
+	maxLength := envInt("MAX_QUERY_STRING_LENGTH", defaultMaxQueryStringLength)
+	maxValueLength := envInt("MAX_QUERY_VALUE_LENGTH", defaultMaxQueryValueLength)
+	strict := os.Getenv("QUERY_PARAMS_STRICT") == "true"
+
+	allowed := make(map[string]map[string]bool, len(routeQueryParams))
+	for route, params := range routeQueryParams {
+		allowed[route] = make(map[string]bool)
+		for _, param := range append(params, commonQueryParams...) {
+			allowed[route][param] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		if err := validateQuery(c.Request.URL, maxLength, maxValueLength); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid query string",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		if params, ok := allowed[c.FullPath()]; ok {
+			for key := range c.Request.URL.Query() {
+				if params[key] {
+					continue
+				}
+				if strict {
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+						"error":   "Unknown query parameter",
+						"details": fmt.Sprintf("%s does not accept %q", c.FullPath(), key),
+					})
+					return
+				}
+				loggerFrom(c.Request.Context()).Warn("Unknown query parameter", "param", key, "route", c.FullPath())
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func validateQuery(u *url.URL, maxLength, maxValueLength int) error {
+	if len(u.RawQuery) > maxLength {
+		return fmt.Errorf("query string is %d characters, the maximum is %d", len(u.RawQuery), maxLength)
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return err
+	}
+	for key, values := range query {
+		for _, value := range values {
+			if len(value) > maxValueLength {
+				return fmt.Errorf("value of %s is %d characters, the maximum is %d", key, len(value), maxValueLength)
+			}
+			if value != values[0] {
+				return fmt.Errorf("%s is given more than once with different values", key)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+// defaultQuotaRetryAfter is the Retry-After, in seconds, sent with the 503
+// for an exhausted BigQuery quota unless QUOTA_RETRY_AFTER overrides it.
+const defaultQuotaRetryAfter = 900
+
+// quotaExceeded reports whether err is BigQuery refusing a query because a
+// project quota, typically the daily query bytes, is used up. The reason
+// comes back on the API error for rejected requests and on the job error for
+// jobs that failed.
+func quotaExceeded(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		for _, item := range apiErr.Errors {
+			if item.Reason == "quotaExceeded" {
+				return true
+			}
+		}
+	}
+	var jobErr *bigquery.Error
+	if errors.As(err, &jobErr) && jobErr.Reason == "quotaExceeded" {
+		return true
+	}
+	return false
+}
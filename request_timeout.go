@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestTimeoutHeader     = "X-Request-Timeout-Ms"
+	minRequestTimeout        = 100 * time.Millisecond
+	defaultMaxRequestTimeout = 60 * time.Second
+)
+
+// maxRequestTimeout caps X-Request-Timeout-Ms, configurable via
+// REQUEST_TIMEOUT_MAX_MS.
+func maxRequestTimeout() time.Duration {
+	value := os.Getenv("REQUEST_TIMEOUT_MAX_MS")
+	if value == "" {
+		return defaultMaxRequestTimeout
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || time.Duration(ms)*time.Millisecond < minRequestTimeout {
+		fmt.Printf("WARNING: Ignoring invalid REQUEST_TIMEOUT_MAX_MS: %s\n", value)
+		return defaultMaxRequestTimeout
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// requestTimeoutMiddleware lets clients bound how long they are willing to
+// wait via X-Request-Timeout-Ms. The value is clamped to
+// [minRequestTimeout, REQUEST_TIMEOUT_MAX_MS] and becomes the request context
+// deadline, which handlers pass on to BigQuery. Invalid values are ignored.
+func requestTimeoutMiddleware() gin.HandlerFunc {
+	maxTimeout := maxRequestTimeout()
+
+	return func(c *gin.Context) {
+		value := c.GetHeader(requestTimeoutHeader)
+		if value == "" {
+			c.Next()
+			return
+		}
+
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms <= 0 {
+			fmt.Printf("WARNING: Ignoring invalid %s header: %q\n", requestTimeoutHeader, value)
+			c.Next()
+			return
+		}
+
+		timeout := time.Duration(ms) * time.Millisecond
+		if timeout < minRequestTimeout {
+			timeout = minRequestTimeout
+		}
+		if timeout > maxTimeout {
+			timeout = maxTimeout
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
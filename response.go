@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+)
+
+// gin already sends JSON as application/json; charset=utf-8, so only CSV and
+// NDJSON need their charset spelled out.
+const (
+	csvContentType    = "text/csv; charset=utf-8"
+	ndjsonContentType = "application/x-ndjson; charset=utf-8"
+)
+
+// ndjsonMetadataHeader opts in to a leading metadata line in NDJSON output.
+const ndjsonMetadataHeader = "X-NDJSON-Metadata"
+
+// queryTimeKey is the gin context key handlers use to record how long their
+// BigQuery work took, for response metadata.
+const queryTimeKey = "query_time"
+
+// fieldsHeader lists the returned columns and their BigQuery types, e.g.
+// "sku:STRING,size:STRING,available:INTEGER", so generic table viewers can
+// build columns without relying on the keys of the first row.
+const fieldsHeader = "X-Fields"
+
+// utf8BOM lets Excel detect UTF-8 so non-ASCII product names open correctly.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// rowSet is a flat query result together with the schema it was read with,
+// so the column order survives caching and CSV output.
+type rowSet struct {
+	Schema bigquery.Schema
+	Rows   []map[string]interface{}
+}
+
+// respondRows writes flat rows as JSON by default, as CSV for ?format=csv or
+// as NDJSON for ?format=ndjson. CSV columns follow the BigQuery schema order
+// and ?bom=true prepends a UTF-8 byte order mark for Excel. For JSON output,
+// ?transform= runs the named row transformers in order (see
+// rowTransformerFactories) and ?omitempty=true then drops null and zero
+// fields to shrink mobile payloads. ?format=arrow or parquet, or an Accept
+// header asking for either, returns an Arrow IPC stream or a Parquet file
+// for analytics clients. X-Fields carries the schema for every format.
+// outputFormatMiddleware has already rejected parameters that don't apply to
+// the resolved format.
+func respondRows(c *gin.Context, status int, schema bigquery.Schema, rows []map[string]interface{}) {
+	serverTimingFrom(c.Request.Context()).rowsDone()
+	c.Header(fieldsHeader, schemaFields(schema, strings.Contains(c.Query("transform"), "camel_case")))
+
+	format := responseFormat(c)
+
+	// CSV, Arrow and Parquet keep a fixed column set, so transforms and
+	// omitempty only shape JSON output
+	if format != "csv" && format != "arrow" && format != "parquet" {
+		transformers, err := parseRowTransformers(c, schema)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid transform parameter",
+				"details": err.Error(),
+			})
+			return
+		}
+		if len(transformers) > 0 {
+			rows = applyRowTransformers(rows, transformers)
+		}
+		if c.Query("omitempty") == "true" {
+			rows = omitZeroFields(rows)
+		}
+	}
+
+	switch format {
+	case "csv":
+		respondCSV(c, status, schema, rows)
+	case "arrow":
+		respondArrow(c, status, schema, rows)
+	case "parquet":
+		respondParquet(c, status, schema, rows)
+	case "ndjson":
+		respondNDJSON(c, status, schema, rows)
+	default:
+		respondJSON(c, status, rows)
+	}
+}
+
+// schemaFields formats schema for the X-Fields header, using the camelCase
+// names when the camel_case transform renames the keys.
+func schemaFields(schema bigquery.Schema, camel bool) string {
+	fields := make([]string, len(schema))
+	for i, field := range schema {
+		name := field.Name
+		if camel {
+			name = camelCase(name)
+		}
+		fields[i] = fmt.Sprintf("%s:%s", name, field.Type)
+	}
+	return strings.Join(fields, ",")
+}
+
+// omitZeroFields returns copies of rows without their null and zero-valued
+// fields. Rows may be shared with a cache, so they are never modified.
+func omitZeroFields(rows []map[string]interface{}) []map[string]interface{} {
+	trimmed := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		trimmed[i] = make(map[string]interface{}, len(row))
+		for key, value := range row {
+			if !isZeroValue(value) {
+				trimmed[i][key] = value
+			}
+		}
+	}
+	return trimmed
+}
+
+// isZeroValue reports whether ?omitempty=true drops value: null, zero
+// numbers of any width including NUMERIC and BIGNUMERIC (*big.Rat), empty
+// strings and false.
+func isZeroValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case *big.Rat:
+		return v == nil || v.Sign() == 0
+	case int:
+		return v == 0
+	case int8:
+		return v == 0
+	case int16:
+		return v == 0
+	case int32:
+		return v == 0
+	case int64:
+		return v == 0
+	case uint:
+		return v == 0
+	case uint8:
+		return v == 0
+	case uint16:
+		return v == 0
+	case uint32:
+		return v == 0
+	case uint64:
+		return v == 0
+	case float32:
+		return v == 0
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	}
+	return false
+}
+
+// respondCSV writes rows as a CSV download. ?delimiter=; and ?decimal=,
+// produce the variant European Excel opens directly.
+func respondCSV(c *gin.Context, status int, schema bigquery.Schema, rows []map[string]interface{}) {
+	var v validator
+	opts := parseCSVOptions(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	start := time.Now()
+	body, err := encodeCSV(schema, rows, opts)
+	serverTimingFrom(c.Request.Context()).add("serialize", time.Since(start))
+	if err != nil {
+		loggerFrom(c.Request.Context()).Error("CSV encoding error", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to encode CSV",
+			"details": err.Error(),
+		})
+		return
+	}
+	if c.Query("bom") == "true" {
+		body = append(utf8BOM, body...)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", csvFilename(c)))
+	c.Data(status, csvContentType, body)
+}
+
+type ndjsonField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type ndjsonMetadata struct {
+	Fields      []ndjsonField `json:"fields"`
+	RowCount    int           `json:"row_count"`
+	QueryTimeMs *int64        `json:"query_time_ms,omitempty"`
+}
+
+// respondNDJSON streams one JSON object per line. With the
+// X-NDJSON-Metadata: true request header the first line is a {"_meta": ...}
+// object describing the columns, so consumers can set up before the rows.
+func respondNDJSON(c *gin.Context, status int, schema bigquery.Schema, rows []map[string]interface{}) {
+	c.Header("Content-Type", ndjsonContentType)
+	c.Status(status)
+	enc := json.NewEncoder(c.Writer)
+
+	if c.GetHeader(ndjsonMetadataHeader) == "true" {
+		meta := ndjsonMetadata{RowCount: len(rows)}
+		for _, field := range schema {
+			meta.Fields = append(meta.Fields, ndjsonField{Name: field.Name, Type: string(field.Type)})
+		}
+		if queryTime, ok := c.Get(queryTimeKey); ok {
+			ms := queryTime.(time.Duration).Milliseconds()
+			meta.QueryTimeMs = &ms
+		}
+		if err := enc.Encode(gin.H{"_meta": meta}); err != nil {
+			loggerFrom(c.Request.Context()).Error("NDJSON write error", "error", err)
+			return
+		}
+	}
+
+	for i, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			loggerFrom(c.Request.Context()).Error("NDJSON write error", "error", err)
+			return
+		}
+		if i%500 == 499 {
+			c.Writer.Flush()
+		}
+	}
+	c.Writer.Flush()
+}
+
+func encodeCSV(schema bigquery.Schema, rows []map[string]interface{}, opts csvOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = opts.Delimiter
+
+	header := make([]string, len(schema))
+	for i, field := range schema {
+		header[i] = field.Name
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, len(schema))
+	for _, row := range rows {
+		for i, field := range schema {
+			record[i] = csvValue(row[field.Name], opts.DecimalComma)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// csvValue renders one CSV cell. Numbers are written as plain decimals, with
+// a decimal comma if decimalComma is set.
+func csvValue(value interface{}, decimalComma bool) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64, float32:
+		if decimalComma {
+			return strings.Replace(fmt.Sprint(v), ".", ",", 1)
+		}
+	case *big.Rat:
+		// NUMERIC and BIGNUMERIC columns; fmt would print them as a fraction
+		decimal := v.RatString()
+		if !v.IsInt() {
+			decimal = strings.TrimRight(v.FloatString(bigquery.BigNumericScaleDigits), "0")
+		}
+		if decimalComma {
+			return strings.Replace(decimal, ".", ",", 1)
+		}
+		return decimal
+	}
+	return fmt.Sprint(value)
+}
+
+// csvFilename derives a download name from the route, e.g.
+// /sku-metrics/ABC123 becomes sku-metrics-ABC123.csv.
+func csvFilename(c *gin.Context) string {
+	name := strings.Trim(path.Clean(c.Request.URL.Path), "/")
+	if name == "" {
+		name = "export"
+	}
+	return strings.ReplaceAll(name, "/", "-") + ".csv"
+}
+
+// respondQueryError reports a failed BigQuery call. A request that ran past
+// its X-Request-Timeout-Ms deadline gets a 504, and a query broken by an
+// upstream schema change a 502 naming the missing columns, instead of a
+// generic 500.
+func respondQueryError(c *gin.Context, err error) {
+	loggerFrom(c.Request.Context()).Error("BigQuery error", "error", err)
+
+	if errors.Is(err, context.DeadlineExceeded) || c.Request.Context().Err() == context.DeadlineExceeded {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":   "Query exceeded the request deadline",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if columns := schemaDriftColumns(err); len(columns) > 0 {
+		loggerFrom(c.Request.Context()).Error("Schema drift: query references missing columns", "route", c.FullPath(), "missing_columns", strings.Join(columns, ", "))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":           "Upstream schema changed",
+			"missing_columns": columns,
+			"details":         err.Error(),
+		})
+		return
+	}
+
+	if errors.Is(err, errQueryCapacity) {
+		c.Header("Retry-After", strconv.Itoa(envInt("QUERY_CAPACITY_RETRY_AFTER", defaultQueryCapacityRetryAfter)))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Query capacity exhausted",
+			"code":    "QUERY_CAPACITY",
+			"message": "Too many queries are running, retry later",
+		})
+		return
+	}
+
+	// Running out of quota is a recurring end-of-month condition; the raw
+	// error only confuses clients, so it stays in the log
+	if quotaExceeded(err) {
+		loggerFrom(c.Request.Context()).Error("BigQuery quota exceeded", "route", c.FullPath(), "error", err)
+		c.Header("Retry-After", strconv.Itoa(envInt("QUOTA_RETRY_AFTER", defaultQuotaRetryAfter)))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Data temporarily unavailable",
+			"code":    "QUOTA_EXCEEDED",
+			"message": "Data temporarily unavailable due to quota, retry later",
+		})
+		return
+	}
+
+	// In a fresh environment the dbt models may not have been built yet;
+	// that is a temporary condition, not a server bug
+	if table := missingTable(err); table != "" {
+		c.Header("Retry-After", strconv.Itoa(missingTableRetryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Table not available yet",
+			"table":   table,
+			"message": "The table this endpoint reads has not been built yet; it is created by the dbt run",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Failed to query BigQuery",
+		"details": err.Error(),
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultMaxResponseBytes = 50 << 20
+
+// maxResponseBytes caps a serialized JSON response, configurable via
+// MAX_RESPONSE_BYTES. 0 disables the check.
+func maxResponseBytes() int {
+	value := os.Getenv("MAX_RESPONSE_BYTES")
+	if value == "" {
+		return defaultMaxResponseBytes
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fmt.Printf("WARNING: Ignoring invalid MAX_RESPONSE_BYTES: %s\n", value)
+		return defaultMaxResponseBytes
+	}
+	return n
+}
+
+// writeJSON marshals data and writes it, unless the body would exceed
+// MAX_RESPONSE_BYTES, in which case the client gets a 413 telling it to
+// narrow the request instead of a body it may not be able to handle.
+func writeJSON(c *gin.Context, status int, data interface{}) {
+	timing := serverTimingFrom(c.Request.Context())
+	timing.rowsDone()
+	start := time.Now()
+	body, err := marshalJSON(data)
+	timing.add("serialize", time.Since(start))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to encode response",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if limit := maxResponseBytes(); limit > 0 && len(body) > limit {
+		loggerFrom(c.Request.Context()).Warn("Response exceeds MAX_RESPONSE_BYTES", "bytes", len(body), "max_bytes", limit)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":     "Response too large",
+			"message":   "Narrow the request with ?limit=/?offset=, ?list= or other filters, or use ?format=ndjson or ?format=csv",
+			"size":      len(body),
+			"max_bytes": limit,
+		})
+		return
+	}
+
+	c.Data(status, "application/json; charset=utf-8", body)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        interface{}
+		decimalComma bool
+		want         string
+	}{
+		{"nil", nil, false, ""},
+		{"string", "38.5", true, "38.5"},
+		{"float", 12.5, false, "12.5"},
+		{"float decimal comma", 12.5, true, "12,5"},
+		{"numeric", big.NewRat(1234, 100), false, "12.34"},
+		{"numeric decimal comma", big.NewRat(1234, 100), true, "12,34"},
+		{"numeric integer", big.NewRat(42, 1), true, "42"},
+		{"numeric negative", big.NewRat(-5, 2), false, "-2.5"},
+		{"bignumeric scale", new(big.Rat).SetFrac64(1, 1_000_000_000_000), false, "0.000000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvValue(tt.value, tt.decimalComma); got != tt.want {
+				t.Errorf("csvValue(%v, %t) = %q, want %q", tt.value, tt.decimalComma, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsZeroValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{"nil", nil, true},
+		{"empty string", "", true},
+		{"string", "0", false},
+		{"false", false, true},
+		{"true", true, false},
+		{"int zero", 0, true},
+		{"int", 3, false},
+		{"int32 zero", int32(0), true},
+		{"int64 zero", int64(0), true},
+		{"int64", int64(-1), false},
+		{"uint8 zero", uint8(0), true},
+		{"uint64", uint64(7), false},
+		{"float32 zero", float32(0), true},
+		{"float64 zero", 0.0, true},
+		{"float64 negative zero", math.Copysign(0, -1), true},
+		{"float64", 0.5, false},
+		{"numeric zero", new(big.Rat), true},
+		{"numeric zero fraction", big.NewRat(0, 5), true},
+		{"numeric", big.NewRat(1, 100), false},
+		{"numeric nil", (*big.Rat)(nil), true},
+		{"date", civil.Date{Year: 2026, Month: 1, Day: 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isZeroValue(tt.value); got != tt.want {
+				t.Errorf("isZeroValue(%v) = %t, want %t", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	maxQueryAttempts         = 3
+	initialRetryBackoff      = 200 * time.Millisecond
+	defaultRetryBudgetMax    = 20
+	defaultRetryBudgetRefill = 1.0
+)
+
+// retryBudget is a token bucket shared by all requests. Every retry spends a
+// token and tokens refill at a fixed rate, so during a widespread BigQuery
+// outage retries dry up instead of multiplying the load on it.
+type retryBudget struct {
+	mu           sync.Mutex
+	tokens       float64
+	max          float64
+	refillPerSec float64
+	last         time.Time
+	denied       int64
+}
+
+type retryBudgetState struct {
+	Tokens       float64 `json:"tokens"`
+	Max          float64 `json:"max"`
+	RefillPerSec float64 `json:"refill_per_sec"`
+	Denied       int64   `json:"denied_total"`
+}
+
+// queryRetryBudget is set up in main once the .env file has been loaded.
+var queryRetryBudget *retryBudget
+
+// newRetryBudget reads RETRY_BUDGET_MAX and RETRY_BUDGET_REFILL_PER_SEC.
+func newRetryBudget() *retryBudget {
+	max := float64(defaultRetryBudgetMax)
+	if value := os.Getenv("RETRY_BUDGET_MAX"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			max = float64(parsed)
+		}
+	}
+	refill := defaultRetryBudgetRefill
+	if value := os.Getenv("RETRY_BUDGET_REFILL_PER_SEC"); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 0 {
+			refill = parsed
+		}
+	}
+	return &retryBudget{tokens: max, max: max, refillPerSec: refill, last: time.Now()}
+}
+
+func (b *retryBudget) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.refillPerSec
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.last = now
+}
+
+// take spends one token, reporting false when the budget is exhausted.
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < 1 {
+		b.denied++
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *retryBudget) state() retryBudgetState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	return retryBudgetState{
+		Tokens:       b.tokens,
+		Max:          b.max,
+		RefillPerSec: b.refillPerSec,
+		Denied:       b.denied,
+	}
+}
+
+// isRetryableQueryError reports whether err is a transient BigQuery failure
+// worth another attempt.
+func isRetryableQueryError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.Code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "backendError", "internalError", "rateLimitExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// readQuery runs the query, retrying transient failures with exponential
+// backoff while the shared retry budget allows it.
+func readQuery(ctx context.Context, query *bigquery.Query) (*bigquery.RowIterator, error) {
+	recordExplainedQuery(ctx, query)
+	applyJobTimeout(ctx, query)
+	applyQueryLabels(ctx, query)
+
+	backoff := initialRetryBackoff
+	for attempt := 1; ; attempt++ {
+		if err := queryConcurrency.acquire(ctx); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		record := queryJobLog.start(ctx)
+		it, err := query.Read(ctx)
+		queryJobLog.finish(record, it, err)
+		queryConcurrency.release()
+		serverTimingFrom(ctx).queryDone(time.Since(start))
+		bqClient.reportResult(err)
+		if err == nil || attempt == maxQueryAttempts || !isRetryableQueryError(err) {
+			return it, err
+		}
+		if !queryRetryBudget.take() {
+			loggerFrom(ctx).Warn("BigQuery retry budget exhausted, not retrying", "error", err)
+			return nil, err
+		}
+
+		loggerFrom(ctx).Warn("BigQuery transient error, retrying", "attempt", attempt, "max_attempts", maxQueryAttempts, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
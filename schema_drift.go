@@ -0,0 +1,46 @@
+package main
+
+import (
+	"regexp"
+)
+
+// schemaDriftPatterns match the BigQuery errors for a query that references
+// a column the upstream (dbt) model no longer has, and capture its name.
+var schemaDriftPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`Unrecognized name: ([A-Za-z0-9_]+)`),
+	regexp.MustCompile(`Name ([A-Za-z0-9_]+) not found inside [A-Za-z0-9_]+`),
+	regexp.MustCompile(`Field name ([A-Za-z0-9_]+) does not exist`),
+}
+
+// schemaDriftColumns returns the missing columns if err is a schema mismatch
+// between our SQL and the tables, or nil for any other error.
+func schemaDriftColumns(err error) []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, pattern := range schemaDriftPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(err.Error(), -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				columns = append(columns, match[1])
+			}
+		}
+	}
+	return columns
+}
+
+// missingTableRetryAfter is the Retry-After, in seconds, sent with the 503
+// for a missing table.
+const missingTableRetryAfter = 300
+
+// missingTablePattern matches the BigQuery error for a table or dataset that
+// doesn't exist, e.g. before dbt has built it in a fresh environment.
+var missingTablePattern = regexp.MustCompile(`Not found: (?:Table|Dataset) ([A-Za-z0-9_.:-]+)`)
+
+// missingTable returns the table (or dataset) err says doesn't exist, or ""
+// for any other error.
+func missingTable(err error) string {
+	if match := missingTablePattern.FindStringSubmatch(err.Error()); match != nil {
+		return match[1]
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+const selfCheckTimeout = 30 * time.Second
+
+// runSelfCheck runs a trivial query through the initialized BigQuery client
+// and prints the outcome, for `golangApi -check` in deploy pipelines. It
+// returns the process exit code.
+func runSelfCheck(ctx context.Context) int {
+	start := time.Now()
+	if err := selfCheckQuery(ctx); err != nil {
+		fmt.Printf("CHECK FAILED: BigQuery query in project %s: %v\n", bigQueryProject, err)
+		return 1
+	}
+	fmt.Printf("CHECK OK: BigQuery query in project %s succeeded in %s\n", bigQueryProject, time.Since(start).Round(time.Millisecond))
+	return 0
+}
+
+func selfCheckQuery(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+
+	query, err := newQuery("SELECT 1 AS ok")
+	if err != nil {
+		return err
+	}
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+	var row []bigquery.Value
+	if err := it.Next(&row); err != nil {
+		if err == iterator.Done {
+			return errors.New("query returned no rows")
+		}
+		return err
+	}
+	return nil
+}
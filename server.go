@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Server defaults. WriteTimeout has to outlast the slowest query we allow
+// (REQUEST_TIMEOUT_MAX_MS, 60s by default) plus retries and encoding, so it
+// is set well above it; the others follow common reverse-proxy settings.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 90 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultShutdownTimeout   = 10 * time.Second
+)
+
+// envDuration reads a duration in seconds from envVar, falling back to def
+// when it is unset or invalid.
+func envDuration(envVar string, def time.Duration) time.Duration {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return def
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		fmt.Printf("WARNING: Ignoring invalid %s: %s\n", envVar, value)
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// newHTTPServer builds the server for handler with timeouts from
+// SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT and
+// SERVER_IDLE_TIMEOUT (seconds) and SERVER_MAX_HEADER_BYTES. With
+// ENABLE_H2C=true it also accepts HTTP/2 over cleartext, for internal callers
+// behind the proxy; HTTP/1.1 clients are unaffected.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	maxHeaderBytes := defaultMaxHeaderBytes
+	if value := os.Getenv("SERVER_MAX_HEADER_BYTES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			maxHeaderBytes = n
+		} else {
+			fmt.Printf("WARNING: Ignoring invalid SERVER_MAX_HEADER_BYTES: %s\n", value)
+		}
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: envDuration("SERVER_READ_HEADER_TIMEOUT", defaultReadHeaderTimeout),
+		ReadTimeout:       envDuration("SERVER_READ_TIMEOUT", defaultReadTimeout),
+		WriteTimeout:      envDuration("SERVER_WRITE_TIMEOUT", defaultWriteTimeout),
+		IdleTimeout:       envDuration("SERVER_IDLE_TIMEOUT", defaultIdleTimeout),
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+
+	if os.Getenv("ENABLE_H2C") == "true" {
+		h2 := &http2.Server{IdleTimeout: server.IdleTimeout}
+		handler = h2c.NewHandler(handler, h2)
+		fmt.Println("HTTP/2 cleartext (h2c) enabled")
+	}
+	server.Handler = handler
+
+	fmt.Printf("Server timeouts: read_header=%s read=%s write=%s idle=%s\n",
+		server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout)
+	return server
+}
+
+// serveUntilSignal runs server until it fails or the process gets SIGINT or
+// SIGTERM, then shuts down gracefully, letting in-flight requests finish
+// within SHUTDOWN_TIMEOUT (seconds, default 10, which fits Cloud Run's
+// termination grace period).
+func serveUntilSignal(server *http.Server) {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-errs:
+		panic(fmt.Sprintf("Failed to start server: %v", err))
+	case sig := <-signals:
+		fmt.Printf("Received %s, shutting down\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("WARNING: Graceful shutdown incomplete: %v\n", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// serverTiming collects the phases of one request for the Server-Timing
+// response header, which browsers show in devtools:
+//
+//	auth      - authentication
+//	bq_query  - BigQuery job and first page (summed over all queries)
+//	bq_rows   - reading and converting rows after the last query returned
+//	serialize - encoding the response body
+//	total     - everything up to the first byte of the response
+type serverTiming struct {
+	mu      sync.Mutex
+	start   time.Time
+	last    time.Time
+	queried bool
+	names   []string
+	totals  map[string]time.Duration
+}
+
+type serverTimingContextKey struct{}
+
+// serverTimingFrom returns the request's timings, or nil outside a request.
+// All methods are no-ops on nil.
+func serverTimingFrom(ctx context.Context) *serverTiming {
+	timing, _ := ctx.Value(serverTimingContextKey{}).(*serverTiming)
+	return timing
+}
+
+func (t *serverTiming) add(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.totals[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.totals[name] += d
+}
+
+// mark records the time since the previous mark as name.
+func (t *serverTiming) mark(name string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	d := now.Sub(t.last)
+	t.last = now
+	t.mu.Unlock()
+	t.add(name, d)
+}
+
+// queryDone records a BigQuery call and restarts the clock for bq_rows.
+func (t *serverTiming) queryDone(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.add("bq_query", d)
+	t.mu.Lock()
+	t.last = time.Now()
+	t.queried = true
+	t.mu.Unlock()
+}
+
+// rowsDone closes the bq_rows phase if a query ran. Responders call it
+// before serializing.
+func (t *serverTiming) rowsDone() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	queried := t.queried
+	t.queried = false
+	t.mu.Unlock()
+	if queried {
+		t.mark("bq_rows")
+	}
+}
+
+func (t *serverTiming) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.names)+1)
+	for _, name := range t.names {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.1f", name, float64(t.totals[name].Microseconds())/1000))
+	}
+	parts = append(parts, fmt.Sprintf("total;dur=%.1f", float64(time.Since(t.start).Microseconds())/1000))
+	return strings.Join(parts, ", ")
+}
+
+// serverTimingWriter adds the Server-Timing header just before the response
+// is first written, once all phases up to serialization are known. Bodiless
+// responses such as 304 only ever call WriteHeader, so it is hooked too.
+type serverTimingWriter struct {
+	gin.ResponseWriter
+	timing *serverTiming
+	once   sync.Once
+}
+
+func (w *serverTimingWriter) setHeader() {
+	w.once.Do(func() {
+		if !w.ResponseWriter.Written() {
+			w.Header().Set("Server-Timing", w.timing.header())
+		}
+	})
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *serverTimingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *serverTimingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// serverTimingMiddleware starts the request's timings. It must run before
+// the auth middleware, with serverTimingMark("auth") right after it. The
+// timings are readable from the same origins corsConfig lets call the API:
+// Timing-Allow-Origin is * when every origin is allowed, else the request's
+// Origin if it is one of AllowOrigins.
+func serverTimingMiddleware(corsConfig cors.Config) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(corsConfig.AllowOrigins))
+	for _, origin := range corsConfig.AllowOrigins {
+		allowed[strings.ToLower(origin)] = true
+	}
+	return func(c *gin.Context) {
+		now := time.Now()
+		timing := &serverTiming{start: now, last: now, totals: make(map[string]time.Duration)}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), serverTimingContextKey{}, timing))
+		c.Writer = &serverTimingWriter{ResponseWriter: c.Writer, timing: timing}
+		if origin := c.GetHeader("Origin"); corsConfig.AllowAllOrigins {
+			c.Header("Timing-Allow-Origin", "*")
+		} else if origin != "" && allowed[strings.ToLower(origin)] {
+			c.Header("Timing-Allow-Origin", origin)
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+		c.Next()
+	}
+}
+
+// serverTimingMark records the time since the previous mark as name.
+func serverTimingMark(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverTimingFrom(c.Request.Context()).mark(name)
+		c.Next()
+	}
+}
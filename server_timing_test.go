@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// TestServerTimingMiddleware checks that bodiless responses still carry
+// Server-Timing and that Timing-Allow-Origin follows the CORS origins.
+func TestServerTimingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(serverTimingMiddleware(cors.Config{AllowOrigins: []string{"https://app.example.com"}}))
+	router.GET("/not-modified", func(c *gin.Context) {
+		c.Status(http.StatusNotModified)
+	})
+
+	tests := []struct {
+		origin     string
+		wantOrigin string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.example.com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/not-modified", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotModified {
+			t.Fatalf("origin %q: status %d, want 304", tt.origin, w.Code)
+		}
+		if w.Header().Get("Server-Timing") == "" {
+			t.Errorf("origin %q: 304 response has no Server-Timing header", tt.origin)
+		}
+		if got := w.Header().Get("Timing-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("origin %q: Timing-Allow-Origin = %q, want %q", tt.origin, got, tt.wantOrigin)
+		}
+	}
+}
+
+// TestServerTimingAllowAllOrigins checks the wildcard used when CORS allows
+// every origin.
+func TestServerTimingAllowAllOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(serverTimingMiddleware(cors.Config{AllowAllOrigins: true}))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("Timing-Allow-Origin"); got != "*" {
+		t.Errorf("Timing-Allow-Origin = %q, want *", got)
+	}
+}
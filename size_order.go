@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultSizeOrder is the apparel letter-size order used unless SIZE_ORDER
+// replaces it.
+var defaultSizeOrder = []string{"XXS", "XS", "S", "M", "L", "XL", "XXL", "XXXL"}
+
+// sizeOrder is SIZE_ORDER, a comma-separated list of sizes in display order,
+// upper-cased so matching ignores case.
+var sizeOrder = sync.OnceValue(func() []string {
+	value := os.Getenv("SIZE_ORDER")
+	if value == "" {
+		return defaultSizeOrder
+	}
+	var order []string
+	for _, size := range strings.Split(value, ",") {
+		if size = strings.ToUpper(strings.TrimSpace(size)); size != "" {
+			order = append(order, size)
+		}
+	}
+	fmt.Printf("Size order: %s\n", strings.Join(order, ", "))
+	return order
+})
+
+var sizeRanks = sync.OnceValue(func() map[string]int {
+	ranks := make(map[string]int)
+	for i, size := range sizeOrder() {
+		if _, ok := ranks[size]; !ok {
+			ranks[size] = i
+		}
+	}
+	return ranks
+})
+
+// sizeLess orders sizes for responses: sizes listed in SIZE_ORDER come first
+// in that order, then numeric sizes by value (so shoe sizes and half sizes
+// sort naturally), then anything else lexically.
+func sizeLess(a, b string) bool {
+	rankA, rankedA := sizeRanks()[strings.ToUpper(a)]
+	rankB, rankedB := sizeRanks()[strings.ToUpper(b)]
+	if rankedA || rankedB {
+		if rankedA && rankedB {
+			return rankA < rankB
+		}
+		return rankedA
+	}
+
+	numA, errA := strconv.ParseFloat(a, 64)
+	numB, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil && numA != numB {
+		return numA < numB
+	}
+	if (errA == nil) != (errB == nil) {
+		return errA == nil
+	}
+	return a < b
+}
+
+// sortRowsBySize returns the rows ordered by their size field with
+// sizeLess. The input may be cached and is left untouched.
+func sortRowsBySize(rows []map[string]interface{}) []map[string]interface{} {
+	sorted := make([]map[string]interface{}, len(rows))
+	copy(sorted, rows)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := sorted[i]["size"].(string)
+		b, _ := sorted[j]["size"].(string)
+		return sizeLess(a, b)
+	})
+	return sorted
+}
+
+// sizeOrderSQL is the ORDER BY expression list matching sizeLess for a
+// size column, with the SIZE_ORDER list bound as @size_order.
+func sizeOrderSQL(column string) string {
+	return `IFNULL((SELECT pos FROM UNNEST(@size_order) AS s WITH OFFSET AS pos WHERE s = UPPER(` + column + `)), ARRAY_LENGTH(@size_order)),
+		  SAFE_CAST(` + column + ` AS FLOAT64) ASC NULLS LAST,
+		  ` + column
+}
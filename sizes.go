@@ -0,0 +1,54 @@
+package main
+
+import "strings"
+
+// halfSizeCodes maps the half-size codes stored in the source tables to their
+// display form. normalizedSizeSQL applies the same mapping in SQL.
+var halfSizeCodes = map[string]string{
+	"385": "38.5",
+	"395": "39.5",
+	"425": "42.5",
+	"435": "43.5",
+}
+
+// oneSize is the display form of one-size products (accessories), which the
+// source tables store without a size or as "0".
+const oneSize = "ONE SIZE"
+
+// normalizeSize returns the display form of a size code, e.g. 385 becomes
+// 38.5 and an empty size or 0 becomes ONE SIZE. Sizes that are already
+// normalized are returned unchanged.
+func normalizeSize(size string) string {
+	if normalized, ok := halfSizeCodes[size]; ok {
+		return normalized
+	}
+	if size = strings.TrimSpace(size); size == "" || size == "0" {
+		return oneSize
+	}
+	return size
+}
+
+// filterRowsBySize keeps the rows whose (normalized) size equals size.
+func filterRowsBySize(rows []map[string]interface{}, size string) []map[string]interface{} {
+	var filtered []map[string]interface{}
+	for _, row := range rows {
+		if rowSize, ok := row["size"].(string); ok && normalizeSize(rowSize) == size {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
+
+// normalizedSizeSQL maps the half-size codes stored in the source tables
+// (385, 395, ...) and missing one-size sizes in column to their display
+// form, like normalizeSize.
+func normalizedSizeSQL(column string) string {
+	return `CASE
+		    WHEN ` + column + ` IS NULL OR TRIM(` + column + `) IN ('', '0') THEN 'ONE SIZE'
+		    WHEN ` + column + ` = '385' THEN '38.5'
+		    WHEN ` + column + ` = '395' THEN '39.5'
+		    WHEN ` + column + ` = '425' THEN '42.5'
+		    WHEN ` + column + ` = '435' THEN '43.5'
+		    ELSE ` + column + `
+		  END`
+}
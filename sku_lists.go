@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxSkuListSize = 5000
+
+var (
+	skuListNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+	// skuPattern matches a base SKU. Base SKUs are 9 characters, the size
+	// code follows them in variant SKUs (see the open_orders CTE).
+	skuPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{9}$`)
+)
+
+// skuLists holds the named SKU lists uploaded via POST /sku-lists. They live
+// in memory only and are gone after a restart.
+var skuLists = struct {
+	sync.RWMutex
+	lists map[string][]string
+}{lists: make(map[string][]string)}
+
+func getSkuList(name string) ([]string, bool) {
+	skuLists.RLock()
+	defer skuLists.RUnlock()
+	skus, ok := skuLists.lists[name]
+	return skus, ok
+}
+
+// postSkuList stores a curated SKU list under ?name= so metrics requests can
+// reference it with ?list=name instead of resending the SKUs. The body is a
+// CSV with the SKU in the first column; an optional sku_id header row is
+// skipped. Every SKU must be well-formed and exist in the products table.
+func postSkuList(c *gin.Context) {
+	name := c.Query("name")
+	if !skuListNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid list name",
+			"details": "name must be 1-64 lowercase letters, digits or dashes",
+		})
+		return
+	}
+
+	skus, invalid, err := readSkuCSV(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid CSV body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid SKU format",
+			"details": invalid,
+		})
+		return
+	}
+	if len(skus) == 0 || len(skus) > maxSkuListSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid list size",
+			"details": fmt.Sprintf("a list must contain between 1 and %d SKUs", maxSkuListSize),
+		})
+		return
+	}
+
+	existing, err := existingSkus(c.Request.Context(), skus)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	var unknown []string
+	for _, sku := range skus {
+		if !existing[sku] {
+			unknown = append(unknown, sku)
+		}
+	}
+	if len(unknown) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Unknown SKUs",
+			"details": unknown,
+		})
+		return
+	}
+
+	skuLists.Lock()
+	skuLists.lists[name] = skus
+	skuLists.Unlock()
+
+	loggerFrom(c.Request.Context()).Info("Stored SKU list", "list", name, "skus", len(skus))
+	c.JSON(http.StatusCreated, gin.H{
+		"name":  name,
+		"count": len(skus),
+	})
+}
+
+// readSkuCSV returns the distinct SKUs from the first CSV column, plus any
+// values that don't look like a SKU.
+func readSkuCSV(body io.Reader) ([]string, []string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+
+	var skus, invalid []string
+	seen := make(map[string]bool)
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sku := normalizeSkuID(record[0])
+		if sku == "" || (line == 0 && strings.EqualFold(sku, "sku_id")) || seen[sku] {
+			continue
+		}
+		seen[sku] = true
+		if !skuPattern.MatchString(sku) {
+			invalid = append(invalid, sku)
+			continue
+		}
+		skus = append(skus, sku)
+	}
+	return skus, invalid, nil
+}
+
+// filterRowsBySkus keeps the rows whose sku is in skus.
+func filterRowsBySkus(rows []map[string]interface{}, skus []string) []map[string]interface{} {
+	wanted := make(map[string]bool, len(skus))
+	for _, sku := range skus {
+		wanted[sku] = true
+	}
+
+	var filtered []map[string]interface{}
+	for _, row := range rows {
+		if sku, ok := row["sku"].(string); ok && wanted[sku] {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
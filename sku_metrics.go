@@ -4,16 +4,111 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
 )
 
+// skuMetricsCache holds the full metrics table read. The table is rebuilt by
+// dbt at most a few times a day, so it uses the long unfiltered TTL and is
+// dropped early when the table changes. Override the TTL with
+// SKU_METRICS_CACHE_TTL (seconds).
+var skuMetricsCache = newResultCache("sku_metrics")
+
 func getSkuMetrics(c *gin.Context) {
-	fmt.Println("SKU metrics requested")
-	ctx := context.Background()
+	loggerFrom(c.Request.Context()).Info("SKU metrics requested")
+
+	// Conditional GET against the table's last modification time. If the
+	// metadata lookup fails we just serve the full response.
+	lastModified, err := tableLastModified(c.Request.Context(), "agent", "sku_sizes_metrics")
+	if err != nil {
+		loggerFrom(c.Request.Context()).Warn("Table metadata error", "error", err)
+	} else {
+		if notModifiedSince(c, lastModified) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		// The unfiltered TTL is long, so drop a result read before the
+		// table was rebuilt
+		skuMetricsCache.invalidateBefore("all", lastModified)
+	}
+
+	// ?sort= pushes the ordering, and any ?limit=, into BigQuery
+	if c.Query("sort") != "" {
+		respondSortedSkuMetrics(c)
+		return
+	}
+	var v validator
+	for _, param := range []string{"order", "limit", "offset"} {
+		if c.Query(param) != "" {
+			v.add(param, param+" requires sort")
+		}
+	}
+	if v.respond(c) {
+		return
+	}
+
+	results, ok := fetchSkuMetrics(c)
+	if !ok {
+		return
+	}
+
+	loggerFrom(c.Request.Context()).Info("Returning SKU metrics", "rows", len(results.Rows))
+	c.Header("Cache-Control", "private, max-age=300")
+	if respondCompressedSkuMetrics(c, http.StatusOK, results) {
+		return
+	}
+	respondRows(c, http.StatusOK, results.Schema, results.Rows)
+}
 
-	query := bqClient.Query(`
+// fetchSkuMetrics returns the cached full metrics table, narrowed to the
+// ?list= SKU list if one was given, and sets X-Cache. On failure it has
+// already written the error response and returns false.
+func fetchSkuMetrics(c *gin.Context) (rowSet, bool) {
+	ttl := unfilteredCacheTTL("SKU_METRICS_CACHE_TTL")
+	queryStart := time.Now()
+	// The shared query runs on a detached context so one impatient client
+	// can't cancel it for everyone waiting on the same result
+	ctx := c.Request.Context()
+	value, hit, err := skuMetricsCache.fetch(ctx, "all", ttl, func() (interface{}, error) {
+		if skuMetricsReadAPI() == "storage" {
+			return readSkuMetricsTable(detachedContext(ctx))
+		}
+		return querySkuMetrics(detachedContext(ctx))
+	})
+	if err != nil {
+		respondQueryError(c, err)
+		return rowSet{}, false
+	}
+	results := value.(rowSet)
+	c.Set(queryTimeKey, time.Since(queryStart))
+
+	// ?list= restricts the response to a SKU list stored via POST /sku-lists
+	if name := c.Query("list"); name != "" {
+		skus, ok := getSkuList(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "SKU list not found",
+				"list":  name,
+			})
+			return rowSet{}, false
+		}
+		results.Rows = filterRowsBySkus(results.Rows, skus)
+	}
+
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	return results, true
+}
+
+// skuMetricsSelectSQL reads the metrics table. Callers may append WHERE,
+// ORDER BY and LIMIT clauses.
+const skuMetricsSelectSQL = `
 		SELECT 
 			sku,
 			name,
@@ -25,9 +120,12 @@ func getSkuMetrics(c *gin.Context) {
 			purchase_price,
 			class,
 			size,
+			SAFE_CAST(size AS FLOAT64) AS size_numeric,
 			available_count,
 			purchased_count,
 			sold_last_24_months,
+			-- sold / (sold + available); NULL rather than NaN when both are 0
+			SAFE_DIVIDE(sold_last_24_months, sold_last_24_months + available_count) AS sell_through,
 			open_orders_quantity,
 			has_half_sizes,
 			is_mto,
@@ -46,45 +144,54 @@ func getSkuMetrics(c *gin.Context) {
 			sold_november,
 			sold_december
 		FROM metal-force-400307.agent.sku_sizes_metrics
-	`)
+	`
 
-	it, err := query.Read(ctx)
+func querySkuMetrics(ctx context.Context) (rowSet, error) {
+	query, err := newQuery(skuMetricsSelectSQL)
 	if err != nil {
-		fmt.Printf("BigQuery error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to query BigQuery",
-			"details": err.Error(),
-		})
-		return
+		return rowSet{}, err
 	}
 
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return rowSet{}, err
+	}
+	return readSkuMetricsRows(ctx, it)
+}
+
+// readSkuMetricsRows converts the rows of a metrics table query.
+func readSkuMetricsRows(ctx context.Context, it *bigquery.RowIterator) (rowSet, error) {
+	logger := loggerFrom(ctx)
 	var results []map[string]interface{}
 	rowCount := 0
 	for {
 		var values []bigquery.Value
 		err := it.Next(&values)
-		if err != nil {
-			fmt.Printf("Iterator error or done: %v\n", err)
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			logger.Error("Iterator error", "error", err)
+			return rowSet{}, err
+		}
 		rowCount++
-		fmt.Printf("=== RAW ROW %d ===\n", rowCount)
-		fmt.Printf("Values: %v\n", values)
+		if debugRows {
+			logger.Info("Raw row", "row", rowCount, "values", fmt.Sprint(values))
+		}
 		
 		// Convert to map using schema
 		row := make(map[string]interface{})
 		schema := it.Schema
 		for i, field := range schema {
 			if i < len(values) {
-				row[field.Name] = values[i]
-				fmt.Printf("  %s: %v (type: %T)\n", field.Name, values[i], values[i])
+				row[field.Name] = convertValue(field, values[i])
+				if debugRows {
+					logger.Info("Row field", "row", rowCount, "field", field.Name, "value", fmt.Sprint(values[i]), "type", fmt.Sprintf("%T", values[i]))
+				}
 			}
 		}
-		fmt.Printf("=== END ROW %d ===\n", rowCount)
 		results = append(results, row)
 	}
 
-	fmt.Printf("Returning %d rows\n", len(results))
-	c.Header("Cache-Control", "private, max-age=300")
-	c.JSON(http.StatusOK, results)
-} 
\ No newline at end of file
+	return rowSet{Schema: it.Schema, Rows: results}, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// clusterTotalColumn carries the unpaged group count on every row of the
+// cluster query. It is stripped before responding.
+const clusterTotalColumn = "total_groups"
+
+// buildSkuMetricsClusterQuery sums the metrics table over one cluster, per
+// SKU or per normalized size. The groupBy value must be "sku" or "size";
+// sizes are ordered like sizeLess, with @size_order bound.
+func buildSkuMetricsClusterQuery(groupBy string, page pagination) string {
+	keys := "a.sku, ANY_VALUE(a.name) AS name, COUNT(DISTINCT a.size) AS sizes"
+	order := "sku"
+	if groupBy == "size" {
+		keys = normalizedSizeSQL("a.size") + " AS size, COUNT(DISTINCT a.sku) AS skus"
+		order = sizeOrderSQL("size")
+	}
+	return `
+		SELECT * FROM (
+		  SELECT
+		    ` + keys + `,
+		    SUM(a.available_count) AS available_count,
+		    SUM(a.purchased_count) AS purchased_count,
+		    SUM(a.sold_last_24_months) AS sold_last_24_months,
+		    SUM(a.open_orders_quantity) AS open_orders_quantity,
+		    COUNT(*) OVER () AS ` + clusterTotalColumn + `
+		  FROM metal-force-400307.agent.sku_sizes_metrics a
+		  WHERE CAST(a.cluster AS STRING) = @cluster
+		  GROUP BY 1
+		)
+		ORDER BY ` + order + `
+		` + page.clause()
+}
+
+// getSkuMetricsCluster serves GET /sku-metrics/cluster/:cluster: available,
+// on-order (purchased_count), sold and open-order totals for every SKU in the
+// cluster, or per size across the cluster with ?group_by=size. Paged with
+// ?limit=/?offset=, with the unpaged group count in X-Total-Count.
+func getSkuMetricsCluster(c *gin.Context) {
+	cluster := strings.TrimSpace(c.Param("cluster"))
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Cluster metrics requested", "cluster", cluster)
+
+	var v validator
+	if cluster == "" {
+		v.add("cluster", "cluster is required")
+	}
+	groupBy := c.DefaultQuery("group_by", "sku")
+	if groupBy != "sku" && groupBy != "size" {
+		v.add("group_by", "group_by must be sku or size")
+	}
+	page := parsePagination(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	query, err := newQuery(buildSkuMetricsClusterQuery(groupBy, page))
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	query.Parameters = append([]bigquery.QueryParameter{
+		{Name: "cluster", Value: cluster},
+	}, page.parameters()...)
+	if groupBy == "size" {
+		query.Parameters = append(query.Parameters, bigquery.QueryParameter{Name: "size_order", Value: sizeOrder()})
+	}
+
+	queryStart := time.Now()
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	rows := []map[string]interface{}{}
+	total := -1
+	for {
+		var values []bigquery.Value
+		err := it.Next(&values)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+
+		row := make(map[string]interface{})
+		for i, field := range it.Schema {
+			if i < len(values) {
+				row[field.Name] = convertValue(field, values[i])
+			}
+		}
+		if count, ok := numericValue(row[clusterTotalColumn]); ok {
+			total = int(count)
+		}
+		delete(row, clusterTotalColumn)
+		rows = append(rows, row)
+	}
+	c.Set(queryTimeKey, time.Since(queryStart))
+
+	// An empty first page means no SKU carries the cluster; past the end of
+	// a real cluster the page is just empty
+	if len(rows) == 0 && page.Offset == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Cluster not found",
+			"cluster": cluster,
+		})
+		return
+	}
+
+	schema := make(bigquery.Schema, 0, len(it.Schema))
+	for _, field := range it.Schema {
+		if field.Name != clusterTotalColumn {
+			schema = append(schema, field)
+		}
+	}
+
+	loggerFrom(ctx).Info("Returning cluster metrics", "cluster", cluster, "group_by", groupBy, "rows", len(rows), "total", total)
+	if total >= 0 {
+		c.Header("X-Total-Count", strconv.Itoa(total))
+	}
+	page.setLinkHeader(c, len(rows), total)
+	c.Header("Cache-Control", "private, max-age=300")
+	respondRows(c, http.StatusOK, schema, rows)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSkuMetricsFingerprint serves GET /sku-metrics/fingerprint: a hash of
+// the /sku-metrics result so monitors can detect changes without downloading
+// it. It reads the same cache and honours ?list= the same way.
+func getSkuMetricsFingerprint(c *gin.Context) {
+	loggerFrom(c.Request.Context()).Info("SKU metrics fingerprint requested")
+
+	// Like /sku-metrics, don't fingerprint a result read before the last
+	// table rebuild
+	lastModified, err := tableLastModified(c.Request.Context(), "agent", "sku_sizes_metrics")
+	if err != nil {
+		loggerFrom(c.Request.Context()).Warn("Table metadata error", "error", err)
+	} else {
+		skuMetricsCache.invalidateBefore("all", lastModified)
+	}
+
+	results, ok := fetchSkuMetrics(c)
+	if !ok {
+		return
+	}
+
+	fingerprint, err := rowsFingerprint(results.Rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to fingerprint results",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"fingerprint": fingerprint,
+		"rows":        len(results.Rows),
+	})
+}
+
+// rowsFingerprint hashes each row, sorts the hashes and hashes the result, so
+// the fingerprint only changes with the data and not with row order. Rows are
+// hashed as JSON, which sorts map keys.
+func rowsFingerprint(rows []map[string]interface{}) (string, error) {
+	hashes := make([]string, len(rows))
+	for i, row := range rows {
+		encoded, err := json.Marshal(row)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(encoded)
+		hashes[i] = hex.EncodeToString(sum[:])
+	}
+	sort.Strings(hashes)
+
+	h := sha256.New()
+	for _, hash := range hashes {
+		h.Write([]byte(hash))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
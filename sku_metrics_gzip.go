@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// skuMetricsGzipBody is the full /sku-metrics JSON response, gzip-compressed
+// once per cached result so polling clients don't cost a marshal and a
+// compression each. source is the stored time of the skuMetricsCache entry
+// it was built from.
+type skuMetricsGzipBody struct {
+	source time.Time
+	body   []byte
+	size   int
+}
+
+var skuMetricsGzip struct {
+	mu      sync.Mutex
+	current skuMetricsGzipBody
+}
+
+// plainJSONRequest reports whether c asks for the default JSON rendering of
+// the full table, with nothing respondRows would change per request. Reads
+// with ?nocache= or ?refresh= are excluded too: their rows may not be the
+// ones skuMetricsCache holds, which the gzip body is keyed to.
+func plainJSONRequest(c *gin.Context) bool {
+	if _, explain := c.Get(explainLogKey); explain {
+		return false
+	}
+	if cacheModeFrom(c.Request.Context()) != cacheNormal {
+		return false
+	}
+	return c.Query("list") == "" &&
+		c.Query("format") == "" &&
+		acceptedFormat(c) == "" &&
+		c.Query("transform") == "" &&
+		c.Query("omitempty") != "true"
+}
+
+// compressedSkuMetrics returns the gzip body for results, building it if the
+// cache entry changed since it was last built. It returns false when the
+// rows aren't cached, as the body would then be thrown away.
+func compressedSkuMetrics(results rowSet) (skuMetricsGzipBody, bool, error) {
+	stored, ok := skuMetricsCache.storedAt("all")
+	if !ok {
+		return skuMetricsGzipBody{}, false, nil
+	}
+
+	skuMetricsGzip.mu.Lock()
+	defer skuMetricsGzip.mu.Unlock()
+	if skuMetricsGzip.current.source.Equal(stored) {
+		return skuMetricsGzip.current, true, nil
+	}
+
+	encoded, err := marshalJSON(results.Rows)
+	if err != nil {
+		return skuMetricsGzipBody{}, false, err
+	}
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(encoded); err != nil {
+		return skuMetricsGzipBody{}, false, err
+	}
+	if err := writer.Close(); err != nil {
+		return skuMetricsGzipBody{}, false, err
+	}
+
+	skuMetricsGzip.current = skuMetricsGzipBody{source: stored, body: compressed.Bytes(), size: len(encoded)}
+	return skuMetricsGzip.current, true, nil
+}
+
+// respondCompressedSkuMetrics serves the full table from the gzip body,
+// as-is to clients accepting gzip and decompressed on the fly for the rest.
+// It returns false if the request should take the regular respondRows path.
+func respondCompressedSkuMetrics(c *gin.Context, status int, results rowSet) bool {
+	if !plainJSONRequest(c) {
+		return false
+	}
+	timing := serverTimingFrom(c.Request.Context())
+	timing.rowsDone()
+	start := time.Now()
+	compressed, ok, err := compressedSkuMetrics(results)
+	timing.add("serialize", time.Since(start))
+	if err != nil {
+		loggerFrom(c.Request.Context()).Warn("Failed to build compressed SKU metrics", "error", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if limit := maxResponseBytes(); limit > 0 && compressed.size > limit {
+		// Let writeJSON answer with its 413
+		return false
+	}
+
+	c.Header(fieldsHeader, schemaFields(results.Schema, false))
+	c.Header("Vary", "Accept-Encoding")
+	if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Header("Content-Encoding", "gzip")
+		c.Data(status, "application/json; charset=utf-8", compressed.body)
+		return true
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed.body))
+	if err != nil {
+		return false
+	}
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(status)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		loggerFrom(c.Request.Context()).Warn("Failed to write decompressed SKU metrics", "error", err)
+	}
+	return true
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip: listed
+// as gzip or x-gzip, or covered by *, with a q-value above zero. A coding
+// listed by name takes precedence over *, so "*, gzip;q=0" refuses gzip.
+func acceptsGzip(header string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip", "x-gzip":
+			gzipQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return wildcardQ > 0
+}
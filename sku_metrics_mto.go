@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getSkuMetricsMTO serves GET /sku-metrics/mto: the made-to-order rows of the
+// metrics table, which fulfillment handles without stock holding. It reads
+// the same cache as /sku-metrics and supports ?list= plus ?limit=/?offset=,
+// with the unpaged row count in X-Total-Count.
+func getSkuMetricsMTO(c *gin.Context) {
+	loggerFrom(c.Request.Context()).Info("MTO SKU metrics requested")
+
+	var v validator
+	page := parsePagination(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	results, ok := fetchSkuMetrics(c)
+	if !ok {
+		return
+	}
+
+	var mto []map[string]interface{}
+	for _, row := range results.Rows {
+		if isMTO, _ := row["is_mto"].(bool); isMTO {
+			mto = append(mto, row)
+		}
+	}
+
+	rows := page.slice(mto)
+	loggerFrom(c.Request.Context()).Info("Returning MTO rows", "rows", len(rows), "total", len(mto))
+	c.Header("X-Total-Count", strconv.Itoa(len(mto)))
+	page.setLinkHeader(c, len(rows), len(mto))
+	c.Header("Cache-Control", "private, max-age=300")
+	respondRows(c, http.StatusOK, results.Schema, rows)
+}
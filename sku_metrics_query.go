@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSoldMonths    = 24
+	defaultMaxSoldMonths = 36
+)
+
+// maxSoldMonths is the largest ?sold_months= an endpoint accepts: envVar if
+// set, else MAX_SOLD_MONTHS (default 36). The window bounds how much order
+// history the query scans, so it is capped per endpoint to keep a client
+// from asking for a ten-year scan.
+func maxSoldMonths(envVar string) int {
+	return envInt(envVar, envInt("MAX_SOLD_MONTHS", defaultMaxSoldMonths))
+}
+
+// parseSoldMonths reads the sold-history window from ?sold_months=,
+// defaulting to 24. Values above maxSoldMonths(limitEnvVar) are rejected
+// rather than clamped, so clients notice. Problems are recorded in v.
+func parseSoldMonths(c *gin.Context, v *validator, limitEnvVar string) int {
+	value := c.Query("sold_months")
+	if value == "" {
+		return defaultSoldMonths
+	}
+	months, err := strconv.Atoi(value)
+	if err != nil || months < 1 {
+		v.add("sold_months", "sold_months must be a positive integer")
+		return 0
+	}
+	if limit := maxSoldMonths(limitEnvVar); months > limit {
+		v.add("sold_months", fmt.Sprintf("sold_months must be at most %d", limit))
+		return 0
+	}
+	return months
+}
+
+// buildSkuMetricsSingleQuery returns the per-size metrics query for a single
+// base SKU, bound via @sku_id. It works straight off the staging tables rather
+// than etiql_agent_seed, so it is fresh but considerably heavier than the
+// materialized sku_sizes_metrics table. Every sold-history CTE reads its
+// window from @sold_months; sold_last_24_months keeps its name for existing
+// clients but covers that window. Open orders are reported both as order
+// lines (open_orders_lines, also kept as open_orders_quantity) and as units
+// ordered (open_orders_units). Sizes are normalized in every CTE, before they
+// are de-duplicated and joined, so each display size gets one row; raw_size
+// is one of the codes stored for it in the source tables. inventory_as_of is
+// the inventory snapshot date available_count comes from.
+func buildSkuMetricsSingleQuery() string {
+	return `
+		WITH latest_inventory_date AS (` + latestInventoryDateSQL + `),
+		inventory_metrics AS (
+		  SELECT
+		      v.base_sku AS sku,
+		      ` + normalizedSizeSQL("v.size") + ` AS size,
+		      MIN(COALESCE(v.size, '')) AS raw_size,
+		      SUM(i.quantity) AS available_count
+		  FROM metal-force-400307.staging.stg_shopify__products_variant v
+		  LEFT JOIN metal-force-400307.staging.stg_xentral__products p ON v.sku = p.sku
+		  LEFT JOIN metal-force-400307.staging.stg_xentral__inventory i ON p.id = i.product_id
+		  CROSS JOIN latest_inventory_date lid
+		  WHERE i.warehouse IS NOT NULL
+		  AND i.date = lid.max_date
+		  AND v.base_sku = @sku_id
+		  GROUP BY 1, 2
+		),
+		purchased_items AS(
+		  SELECT
+		      pod.base_sku AS sku,
+		      ` + normalizedSizeSQL("pod.size") + ` AS size,
+		      MIN(COALESCE(pod.size, '')) AS raw_size,
+		      SUM(pod.quantity) AS purchased_count
+		  FROM metal-force-400307.staging.stg_xentral__purchase_order_details pod
+		  WHERE CAST(pod.confirmed_delivery_date AS DATE) >= CURRENT_DATE()
+		  AND pod.base_sku = @sku_id
+		  GROUP BY 1, 2
+		),
+		sold_items_total AS (
+		  SELECT
+		    v.base_sku AS sku,
+		    ` + normalizedSizeSQL("SUBSTRING(v.sku, 10)") + ` AS size,
+		    MIN(SUBSTRING(v.sku, 10)) AS raw_size,
+		    SUM(o.item_quantity) AS total_sold
+		  FROM metal-force-400307.staging.stg_shopify__orders_items o
+		  LEFT JOIN metal-force-400307.staging.stg_shopify__products_variant v ON o.variant_id = v.id
+		  WHERE EXTRACT(DATE FROM o.created_at) >= DATE_SUB(CURRENT_DATE(), INTERVAL @sold_months MONTH)
+		  AND v.base_sku = @sku_id
+		  GROUP BY 1, 2
+		),
+		sold_items_monthly AS (
+		  SELECT
+		    v.base_sku AS sku,
+		    ` + normalizedSizeSQL("SUBSTRING(v.sku, 10)") + ` AS size,
+		    FORMAT_DATE('%Y%m', o.created_at) AS year_month,
+		    FORMAT_DATE('%B', o.created_at) AS month_name,
+		    EXTRACT(MONTH FROM o.created_at) AS month_number,
+		    EXTRACT(YEAR FROM o.created_at) AS year,
+		    SUM(o.item_quantity) AS monthly_sold
+		  FROM metal-force-400307.staging.stg_shopify__orders_items o
+		  LEFT JOIN metal-force-400307.staging.stg_shopify__products_variant v ON o.variant_id = v.id
+		  WHERE EXTRACT(DATE FROM o.created_at) >= DATE_SUB(CURRENT_DATE(), INTERVAL @sold_months MONTH)
+		  AND v.base_sku = @sku_id
+		  GROUP BY 1, 2, 3, 4, 5, 6
+		),
+		sold_items_monthly_pivot AS (
+		  SELECT
+		    sku,
+		    size,
+		    MAX(CASE WHEN month_name = 'January' THEN monthly_sold ELSE 0 END) AS sold_january,
+		    MAX(CASE WHEN month_name = 'February' THEN monthly_sold ELSE 0 END) AS sold_february,
+		    MAX(CASE WHEN month_name = 'March' THEN monthly_sold ELSE 0 END) AS sold_march,
+		    MAX(CASE WHEN month_name = 'April' THEN monthly_sold ELSE 0 END) AS sold_april,
+		    MAX(CASE WHEN month_name = 'May' THEN monthly_sold ELSE 0 END) AS sold_may,
+		    MAX(CASE WHEN month_name = 'June' THEN monthly_sold ELSE 0 END) AS sold_june,
+		    MAX(CASE WHEN month_name = 'July' THEN monthly_sold ELSE 0 END) AS sold_july,
+		    MAX(CASE WHEN month_name = 'August' THEN monthly_sold ELSE 0 END) AS sold_august,
+		    MAX(CASE WHEN month_name = 'September' THEN monthly_sold ELSE 0 END) AS sold_september,
+		    MAX(CASE WHEN month_name = 'October' THEN monthly_sold ELSE 0 END) AS sold_october,
+		    MAX(CASE WHEN month_name = 'November' THEN monthly_sold ELSE 0 END) AS sold_november,
+		    MAX(CASE WHEN month_name = 'December' THEN monthly_sold ELSE 0 END) AS sold_december
+		  FROM sold_items_monthly
+		  GROUP BY 1, 2
+		),
+		open_orders AS (
+		  SELECT
+		    SUBSTRING(o.product_sku, 1, 9) AS base_sku,
+		    ` + normalizedSizeSQL("SUBSTRING(o.product_sku, 10)") + ` AS size,
+		    MIN(SUBSTRING(o.product_sku, 10)) AS raw_size,
+		    COUNT(*) AS lines,
+		    SUM(o.quantity) AS units
+		  FROM metal-force-400307.staging.stg_xentral__open_orders o
+		  WHERE o.product_sku IS NOT NULL
+		  AND o.order_date >= '2024-09-01'
+		  AND SUBSTRING(o.product_sku, 1, 9) = @sku_id
+		  GROUP BY 1, 2
+		),
+		products AS (
+		  SELECT
+		    SUBSTRING(pr.sku, 1, 9) AS base_sku,
+		    ` + normalizedSizeSQL("SUBSTRING(pr.sku, 10)") + ` AS size,
+		    MIN(pr.id) AS id
+		  FROM metal-force-400307.staging.stg_xentral__products pr
+		  WHERE SUBSTRING(pr.sku, 1, 9) = @sku_id
+		  GROUP BY 1, 2
+		),
+		-- Every CTE above groups by the normalized size, so '' and '0' (both
+		-- ONE SIZE) or 385 and 38.5 collapse into one row before the DISTINCT
+		all_sizes AS (
+		  SELECT sku, size, MIN(raw_size) AS raw_size
+		  FROM (
+		    SELECT sku, size, raw_size FROM inventory_metrics
+		    UNION ALL
+		    SELECT sku, size, raw_size FROM purchased_items
+		    UNION ALL
+		    SELECT sku, size, raw_size FROM sold_items_total
+		    UNION ALL
+		    SELECT base_sku as sku, size, raw_size FROM open_orders
+		  )
+		  GROUP BY 1, 2
+		)
+		SELECT DISTINCT
+		  a.sku,
+		  pr.id as product_id,
+		  a.size,
+		  a.raw_size,
+		  SAFE_CAST(a.size AS FLOAT64) AS size_numeric,
+		  COALESCE(i.available_count, 0) as available_count,
+		  COALESCE(p.purchased_count, 0) as purchased_count,
+		  COALESCE(st.total_sold, 0) as sold_last_24_months,
+		  -- sold / (sold + available); NULL rather than NaN when both are 0
+		  SAFE_DIVIDE(COALESCE(st.total_sold, 0), COALESCE(st.total_sold, 0) + COALESCE(i.available_count, 0)) as sell_through,
+		  COALESCE(sm.sold_january, 0) as sold_january,
+		  COALESCE(sm.sold_february, 0) as sold_february,
+		  COALESCE(sm.sold_march, 0) as sold_march,
+		  COALESCE(sm.sold_april, 0) as sold_april,
+		  COALESCE(sm.sold_may, 0) as sold_may,
+		  COALESCE(sm.sold_june, 0) as sold_june,
+		  COALESCE(sm.sold_july, 0) as sold_july,
+		  COALESCE(sm.sold_august, 0) as sold_august,
+		  COALESCE(sm.sold_september, 0) as sold_september,
+		  COALESCE(sm.sold_october, 0) as sold_october,
+		  COALESCE(sm.sold_november, 0) as sold_november,
+		  COALESCE(sm.sold_december, 0) as sold_december,
+		  -- open_orders_quantity predates the split and counts order lines;
+		  -- use open_orders_lines (order lines) or open_orders_units (pieces)
+		  COALESCE(o.lines, 0) as open_orders_quantity,
+		  COALESCE(o.lines, 0) as open_orders_lines,
+		  COALESCE(o.units, 0) as open_orders_units,
+		  (SELECT max_date FROM latest_inventory_date) as inventory_as_of
+		FROM all_sizes a
+		LEFT JOIN inventory_metrics i ON a.sku = i.sku AND a.size = i.size
+		LEFT JOIN purchased_items p ON a.sku = p.sku AND a.size = p.size
+		LEFT JOIN sold_items_total st ON a.sku = st.sku AND a.size = st.size
+		LEFT JOIN sold_items_monthly_pivot sm ON a.sku = sm.sku AND a.size = sm.size
+		LEFT JOIN open_orders o ON a.sku = o.base_sku AND a.size = o.size
+		LEFT JOIN products pr ON a.sku = pr.base_sku AND a.size = pr.size
+		WHERE a.sku = @sku_id
+		ORDER BY size_numeric ASC NULLS LAST, size
+	`
+}
+
+// buildInventoryByWarehouseQuery returns the latest inventory snapshot for a
+// base SKU (bound via @sku_id) split by warehouse, one row per size and
+// warehouse. Sizes are normalized the same way as the metrics query so the
+// two can be joined on size.
+func buildInventoryByWarehouseQuery() string {
+	return `
+		WITH latest_inventory_date AS (
+		  SELECT MAX(date) AS max_date
+		  FROM metal-force-400307.staging.stg_xentral__inventory
+		  WHERE warehouse IS NOT NULL
+		)
+		SELECT
+		  ` + normalizedSizeSQL("a.size") + ` AS size,
+		  a.warehouse,
+		  a.quantity
+		FROM (
+		  SELECT
+		      v.size,
+		      i.warehouse,
+		      SUM(i.quantity) AS quantity
+		  FROM metal-force-400307.staging.stg_shopify__products_variant v
+		  JOIN metal-force-400307.staging.stg_xentral__products p ON v.sku = p.sku
+		  JOIN metal-force-400307.staging.stg_xentral__inventory i ON p.id = i.product_id
+		  CROSS JOIN latest_inventory_date lid
+		  WHERE i.warehouse IS NOT NULL
+		  AND i.date = lid.max_date
+		  AND v.base_sku = @sku_id
+		  GROUP BY 1, 2
+		) a
+	`
+}
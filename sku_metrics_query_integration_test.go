@@ -0,0 +1,99 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// The integration tests run the queries against BigQuery, with the same
+// credentials the server uses:
+//
+//	go test -tags integration -run Integration
+//
+// INTEGRATION_SKU names a base SKU to read; without it only the dry runs,
+// which validate the SQL against the live schema at no cost, are done.
+
+var integrationClientOnce sync.Once
+
+func integrationClient(t *testing.T) {
+	t.Helper()
+	integrationClientOnce.Do(func() {
+		ctx := context.Background()
+		credentials, err := bigQueryCredentials(ctx)
+		if err != nil {
+			t.Fatalf("loading BigQuery credentials: %v", err)
+		}
+		bqClient, err = newBigQueryClient(ctx, func(ctx context.Context) (*bigquery.Client, error) {
+			return bigquery.NewClient(ctx, bigQueryProject, credentials...)
+		})
+		if err != nil {
+			t.Fatalf("creating BigQuery client: %v", err)
+		}
+	})
+	if bqClient == nil {
+		t.Skip("no BigQuery client")
+	}
+}
+
+func TestIntegrationSkuMetricsSingleQueryDryRun(t *testing.T) {
+	integrationClient(t)
+	ctx := context.Background()
+
+	for name, sql := range map[string]string{
+		"single":       buildSkuMetricsSingleQuery(),
+		"by_warehouse": buildInventoryByWarehouseQuery(),
+	} {
+		query, err := newQuery(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		query.DryRun = true
+		query.Parameters = []bigquery.QueryParameter{
+			{Name: "sku_id", Value: "DRYRUN000"},
+			{Name: "sold_months", Value: defaultSoldMonths},
+		}
+		if _, err := query.Run(ctx); err != nil {
+			t.Errorf("%s: dry run failed: %v", name, err)
+		}
+	}
+}
+
+func TestIntegrationSkuMetricsSingleQuery(t *testing.T) {
+	skuId := os.Getenv("INTEGRATION_SKU")
+	if skuId == "" {
+		t.Skip("INTEGRATION_SKU not set")
+	}
+	integrationClient(t)
+
+	metrics, err := querySkuMetricsSingle(context.Background(), normalizeSkuID(skuId), defaultSoldMonths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.Rows) == 0 {
+		t.Fatalf("no rows for %s", skuId)
+	}
+
+	columns := make(map[string]bool, len(metrics.Schema))
+	for _, field := range metrics.Schema {
+		columns[field.Name] = true
+	}
+	for _, name := range []string{"sku", "size", "available_count", "purchased_count", "sold_last_24_months", "open_orders_quantity"} {
+		if !columns[name] {
+			t.Errorf("column %s missing from the result", name)
+		}
+	}
+	seen := make(map[string]bool, len(metrics.Rows))
+	for _, row := range metrics.Rows {
+		size, _ := row["size"].(string)
+		if seen[size] {
+			t.Errorf("size %q returned more than once", size)
+		}
+		seen[size] = true
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestQueryGolden compares the generated SQL with the files in testdata, so
+// any change to a query shows up in review as a diff of the SQL itself. Run
+// go test -run TestQueryGolden -update to accept a change.
+func TestQueryGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		sql    string
+	}{
+		{"sku_metrics_single.golden.sql", buildSkuMetricsSingleQuery()},
+		{"inventory_by_warehouse.golden.sql", buildInventoryByWarehouseQuery()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(tt.sql), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.sql != string(want) {
+				t.Errorf("SQL differs from %s; run with -update if the change is intended\n%s", path, tt.sql)
+			}
+		})
+	}
+}
+
+func TestQueryDatasets(t *testing.T) {
+	for name, sql := range map[string]string{
+		"single":       buildSkuMetricsSingleQuery(),
+		"by_warehouse": buildInventoryByWarehouseQuery(),
+	} {
+		if err := checkQueryDatasets(sql); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
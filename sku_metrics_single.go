@@ -4,13 +4,63 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
 )
 
+// skuMetricsSingleCache holds single-SKU results keyed by SKU and sold
+// window. POST /admin/warm/:sku_id fills it ahead of a lookup.
+var skuMetricsSingleCache = newResultCache("sku_metrics_single")
+
+func skuMetricsSingleKey(skuId string, soldMonths int) string {
+	return fmt.Sprintf("%s:%d", skuId, soldMonths)
+}
+
+// skuMetricsSingleTTL is SKU_METRICS_SINGLE_CACHE_TTL, or the filtered
+// query TTL, five minutes by default to match the Cache-Control max-age.
+func skuMetricsSingleTTL() time.Duration {
+	return filteredCacheTTL("SKU_METRICS_SINGLE_CACHE_TTL")
+}
+
+// fetchSkuMetricsSingle returns the metrics rows for one SKU from the cache,
+// querying BigQuery on a miss. The returned bool reports a cache hit. Empty
+// results aren't stored: they mostly come from unknown or mistyped SKUs,
+// which would otherwise fill the cache with client-chosen keys, and callers
+// check skuExists for them anyway.
+func fetchSkuMetricsSingle(ctx context.Context, skuId string, soldMonths int) (rowSet, bool, error) {
+	// The shared query runs on a detached context so one impatient client
+	// can't cancel it for everyone waiting on the same SKU
+	value, hit, err := skuMetricsSingleCache.fetch(ctx, skuMetricsSingleKey(skuId, soldMonths), skuMetricsSingleTTL(), func() (interface{}, error) {
+		results, err := querySkuMetricsSingle(detachedContext(ctx), skuId, soldMonths)
+		if err == nil && len(results.Rows) == 0 {
+			return uncached{results}, nil
+		}
+		return results, err
+	})
+	if err != nil {
+		return rowSet{}, false, err
+	}
+	return value.(rowSet), hit, nil
+}
+
+const defaultSkuMaxSizes = 200
+
+// skuExistsHeader tells an existing SKU without metrics rows, answered with
+// an empty row set, from an unknown one, answered with 404.
+const skuExistsHeader = "X-Sku-Exists"
+
+// skuMaxSizes is SKU_MAX_SIZES, the most size rows a single-SKU response
+// returns.
+func skuMaxSizes() int {
+	return envInt("SKU_MAX_SIZES", defaultSkuMaxSizes)
+}
+
 func getSkuMetricsSingle(c *gin.Context) {
-	skuId := c.Param("sku_id")
+	skuId := normalizeSkuID(c.Param("sku_id"))
 	if skuId == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "SKU ID is required",
@@ -18,160 +68,270 @@ func getSkuMetricsSingle(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("SKU metrics requested for: %s\n", skuId)
-	ctx := context.Background()
-
-	// Modified query to work with a single SKU without etiql_agent_seed
-	query := bqClient.Query(`
-		WITH latest_inventory_date AS (
-		  SELECT MAX(date) AS max_date
-		  FROM metal-force-400307.staging.stg_xentral__inventory
-		  WHERE warehouse IS NOT NULL
-		),
-		inventory_metrics AS (
-		  SELECT
-		      v.base_sku AS sku,
-		      v.size,
-		      SUM(i.quantity) AS available_count
-		  FROM metal-force-400307.staging.stg_shopify__products_variant v
-		  LEFT JOIN metal-force-400307.staging.stg_xentral__products p ON v.sku = p.sku
-		  LEFT JOIN metal-force-400307.staging.stg_xentral__inventory i ON p.id = i.product_id
-		  CROSS JOIN latest_inventory_date lid
-		  WHERE i.warehouse IS NOT NULL
-		  AND i.date = lid.max_date
-		  AND v.base_sku = @sku_id
-		  GROUP BY 1, 2
-		),
-		purchased_items AS(
-		  SELECT
-		      pod.base_sku AS sku,
-		      pod.size,
-		      SUM(pod.quantity) AS purchased_count
-		  FROM metal-force-400307.staging.stg_xentral__purchase_order_details pod
-		  WHERE CAST(pod.confirmed_delivery_date AS DATE) >= CURRENT_DATE()
-		  AND pod.base_sku = @sku_id
-		  GROUP BY 1, 2
-		),
-		sold_items_total AS (
-		  SELECT
-		    v.base_sku AS sku,
-		    SUBSTRING(v.sku, 10) AS size,
-		    SUM(o.item_quantity) AS total_sold
-		  FROM metal-force-400307.staging.stg_shopify__orders_items o
-		  LEFT JOIN metal-force-400307.staging.stg_shopify__products_variant v ON o.variant_id = v.id
-		  WHERE EXTRACT(DATE FROM o.created_at) >= DATE_SUB(CURRENT_DATE(), INTERVAL 24 MONTH)
-		  AND v.base_sku = @sku_id
-		  GROUP BY 1, 2
-		),
-		sold_items_monthly AS (
-		  SELECT
-		    v.base_sku AS sku,
-		    SUBSTRING(v.sku, 10) AS size,
-		    FORMAT_DATE('%Y%m', o.created_at) AS year_month,
-		    FORMAT_DATE('%B', o.created_at) AS month_name,
-		    EXTRACT(MONTH FROM o.created_at) AS month_number,
-		    EXTRACT(YEAR FROM o.created_at) AS year,
-		    SUM(o.item_quantity) AS monthly_sold
-		  FROM metal-force-400307.staging.stg_shopify__orders_items o
-		  LEFT JOIN metal-force-400307.staging.stg_shopify__products_variant v ON o.variant_id = v.id
-		  WHERE EXTRACT(DATE FROM o.created_at) >= DATE_SUB(CURRENT_DATE(), INTERVAL 24 MONTH)
-		  AND v.base_sku = @sku_id
-		  GROUP BY 1, 2, 3, 4, 5, 6
-		),
-		sold_items_monthly_pivot AS (
-		  SELECT
-		    sku,
-		    size,
-		    MAX(CASE WHEN month_name = 'January' THEN monthly_sold ELSE 0 END) AS sold_january,
-		    MAX(CASE WHEN month_name = 'February' THEN monthly_sold ELSE 0 END) AS sold_february,
-		    MAX(CASE WHEN month_name = 'March' THEN monthly_sold ELSE 0 END) AS sold_march,
-		    MAX(CASE WHEN month_name = 'April' THEN monthly_sold ELSE 0 END) AS sold_april,
-		    MAX(CASE WHEN month_name = 'May' THEN monthly_sold ELSE 0 END) AS sold_may,
-		    MAX(CASE WHEN month_name = 'June' THEN monthly_sold ELSE 0 END) AS sold_june,
-		    MAX(CASE WHEN month_name = 'July' THEN monthly_sold ELSE 0 END) AS sold_july,
-		    MAX(CASE WHEN month_name = 'August' THEN monthly_sold ELSE 0 END) AS sold_august,
-		    MAX(CASE WHEN month_name = 'September' THEN monthly_sold ELSE 0 END) AS sold_september,
-		    MAX(CASE WHEN month_name = 'October' THEN monthly_sold ELSE 0 END) AS sold_october,
-		    MAX(CASE WHEN month_name = 'November' THEN monthly_sold ELSE 0 END) AS sold_november,
-		    MAX(CASE WHEN month_name = 'December' THEN monthly_sold ELSE 0 END) AS sold_december
-		  FROM sold_items_monthly
-		  GROUP BY 1, 2
-		),
-		open_orders AS (
-		  SELECT
-		    SUBSTRING(o.product_sku, 1, 9) AS base_sku,
-		    SUBSTRING(o.product_sku, 10) AS size,
-		    COUNT(*) as quantity
-		  FROM metal-force-400307.staging.stg_xentral__open_orders o
-		  WHERE o.product_sku IS NOT NULL
-		  AND o.order_date >= '2024-09-01'
-		  AND SUBSTRING(o.product_sku, 1, 9) = @sku_id
-		  GROUP BY 1, 2
-		),
-		all_sizes AS (
-		  SELECT DISTINCT sku, size
-		  FROM (
-		    SELECT sku, size FROM inventory_metrics WHERE size IS NOT NULL
-		    UNION ALL
-		    SELECT sku, size FROM purchased_items WHERE size IS NOT NULL
-		    UNION ALL
-		    SELECT sku, size FROM sold_items_total WHERE size IS NOT NULL
-		    UNION ALL
-		    SELECT base_sku as sku, size FROM open_orders WHERE size IS NOT NULL
-		  )
-		)
-		SELECT DISTINCT
-		  a.sku,
-		  pr.id as product_id,
-		  CASE
-		    WHEN a.size = '385' THEN '38.5'
-		    WHEN a.size = '395' THEN '39.5'
-		    WHEN a.size = '425' THEN '42.5'
-		    WHEN a.size = '435' THEN '43.5'
-		    ELSE a.size
-		  END AS size,
-		  COALESCE(i.available_count, 0) as available_count,
-		  COALESCE(p.purchased_count, 0) as purchased_count,
-		  COALESCE(st.total_sold, 0) as sold_last_24_months,
-		  COALESCE(sm.sold_january, 0) as sold_january,
-		  COALESCE(sm.sold_february, 0) as sold_february,
-		  COALESCE(sm.sold_march, 0) as sold_march,
-		  COALESCE(sm.sold_april, 0) as sold_april,
-		  COALESCE(sm.sold_may, 0) as sold_may,
-		  COALESCE(sm.sold_june, 0) as sold_june,
-		  COALESCE(sm.sold_july, 0) as sold_july,
-		  COALESCE(sm.sold_august, 0) as sold_august,
-		  COALESCE(sm.sold_september, 0) as sold_september,
-		  COALESCE(sm.sold_october, 0) as sold_october,
-		  COALESCE(sm.sold_november, 0) as sold_november,
-		  COALESCE(sm.sold_december, 0) as sold_december,
-		  COALESCE(o.quantity, 0) as open_orders_quantity
-		FROM all_sizes a
-		LEFT JOIN inventory_metrics i ON a.sku = i.sku AND a.size = i.size
-		LEFT JOIN purchased_items p ON a.sku = p.sku AND a.size = p.size
-		LEFT JOIN sold_items_total st ON a.sku = st.sku AND a.size = st.size
-		LEFT JOIN sold_items_monthly_pivot sm ON a.sku = sm.sku AND a.size = sm.size
-		LEFT JOIN open_orders o ON a.sku = o.base_sku AND a.size = o.size
-		LEFT JOIN metal-force-400307.staging.stg_xentral__products pr ON CONCAT(a.sku, a.size) = pr.sku
-		WHERE a.sku = @sku_id
-	`)
-
-	// Set the SKU parameter
+	loggerFrom(c.Request.Context()).Info("SKU metrics requested", "sku", skuId)
+
+	var v validator
+	soldMonths := parseSoldMonths(c, &v, "SKU_METRICS_MAX_SOLD_MONTHS")
+	monthly := c.Query("monthly")
+	if monthly != "" && monthly != "month_name" && monthly != "year_month" {
+		v.add("monthly", "monthly must be month_name or year_month")
+	}
+	layout := c.DefaultQuery("layout", "rows")
+	if layout != "rows" && layout != "matrix" {
+		v.add("layout", "layout must be rows or matrix")
+	} else if layout == "matrix" && responseFormat(c) != "json" {
+		v.add("layout", "layout=matrix is only available as JSON")
+	}
+	poFilters := purchaseOrderFilters(c, &v, "SKU_METRICS_MAX_DELIVERY_WINDOW_MONTHS")
+	if v.respond(c) {
+		return
+	}
+	ctx := c.Request.Context()
+
+	// ?include=purchase_orders fetches the SKU's upcoming PO items alongside
+	// the metrics
+	var purchaseOrders chan purchaseOrderItemsResult
+	if c.Query("include") == "purchase_orders" {
+		purchaseOrders = make(chan purchaseOrderItemsResult, 1)
+		go func() {
+			items, err := queryPurchaseOrderItems(ctx, skuId, poFilters, pagination{})
+			purchaseOrders <- purchaseOrderItemsResult{items, err}
+		}()
+	}
+
+	queryStart := time.Now()
+	metrics, hit, err := fetchSkuMetricsSingle(ctx, skuId, soldMonths)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	// Sizes come back in SQL order, which puts letter sizes in alphabetical
+	// order (L, M, S); sort them by SIZE_ORDER instead
+	results := sortRowsBySize(metrics.Rows)
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+
+	c.Set(queryTimeKey, time.Since(queryStart))
+	loggerFrom(ctx).Info("Returning size records", "sku", skuId, "rows", len(results))
+	
+	// No rows can mean an unknown SKU or a real SKU without any inventory,
+	// sales or orders yet; only the former is a 404. The latter gets the
+	// usual empty row set in the requested format, flagged by X-Sku-Exists
+	if len(results) == 0 {
+		exists, err := skuExists(ctx, skuId)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		c.Header(skuExistsHeader, strconv.FormatBool(exists))
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "SKU not found",
+				"sku":    skuId,
+				"exists": false,
+			})
+			return
+		}
+	}
+
+	// ?size= narrows the response to one size; both the raw code (425) and
+	// the display form (42.5) are accepted
+	if size := c.Query("size"); size != "" {
+		results = filterRowsBySize(results, normalizeSize(size))
+		if len(results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Size not found for SKU",
+				"sku":   skuId,
+				"size":  size,
+			})
+			return
+		}
+	}
+
+	// A SKU with more sizes than SKU_MAX_SIZES almost always means a bad
+	// join upstream, so cap the rows and flag it rather than serve them all
+	if maxSizes := skuMaxSizes(); len(results) > maxSizes {
+		loggerFrom(ctx).Warn("SKU has more sizes than SKU_MAX_SIZES, truncating", "sku", skuId, "sizes", len(results), "max", maxSizes)
+		c.Header("X-Truncated", "true")
+		c.Header("X-Total-Count", strconv.Itoa(len(results)))
+		results = results[:maxSizes]
+	}
+
+	// ?by_warehouse=true splits available_count per warehouse; the total
+	// stays in available_count
+	if c.Query("by_warehouse") == "true" {
+		inventory, err := queryInventoryByWarehouse(ctx, skuId)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		results = addWarehouseBreakdown(results, inventory)
+	}
+
+	if purchaseOrders != nil {
+		result := <-purchaseOrders
+		if result.err != nil {
+			respondQueryError(c, result.err)
+			return
+		}
+		results = addPurchaseOrderItems(results, result.items.Rows)
+	}
+
+	// ?monthly=year_month replaces the sold_<month> pivot, which merges the
+	// same month of different years, with true YYYY-MM buckets
+	if monthly == "year_month" {
+		sold, err := querySoldByMonth(ctx, skuId, soldMonths)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		results = addSoldByMonth(results, sold, soldWindowMonths(soldMonths, time.Now()))
+	}
+
+	// ?raw_sizes=true returns the size codes as stored (385 rather than
+	// 38.5) for clients joining back to the source systems, along with the
+	// raw_size column; without it raw_size is left out. This runs last
+	// since the warehouse and PO lookups match on the normalized size.
+	schema := metrics.Schema
+	if c.Query("raw_sizes") == "true" {
+		results = withRawSizes(results)
+	} else {
+		schema, results = withoutRawSizes(schema, results)
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	if layout == "matrix" {
+		respondJSON(c, http.StatusOK, sizeMatrix(skuId, results))
+		return
+	}
+	respondRows(c, http.StatusOK, schema, results)
+}
+
+// sizeMatrix pivots the per-size rows for ?layout=matrix: metrics maps each
+// size to that row's other fields, and sizes lists the sizes in row order,
+// since JSON object keys carry no order.
+func sizeMatrix(skuId string, rows []map[string]interface{}) gin.H {
+	sizes := make([]string, 0, len(rows))
+	metrics := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		size, _ := row["size"].(string)
+		values := make(map[string]interface{}, len(row))
+		for key, value := range row {
+			if key != "size" {
+				values[key] = value
+			}
+		}
+		sizes = append(sizes, size)
+		metrics[size] = values
+	}
+	return gin.H{
+		"sku":     skuId,
+		"sizes":   sizes,
+		"metrics": metrics,
+	}
+}
+
+// withRawSizes returns copies of rows with size set to raw_size. Rows cached
+// before raw_size was added keep their size.
+func withRawSizes(rows []map[string]interface{}) []map[string]interface{} {
+	raw := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row))
+		for key, value := range row {
+			copied[key] = value
+		}
+		if rawSize, ok := row["raw_size"].(string); ok {
+			copied["size"] = rawSize
+		}
+		raw[i] = copied
+	}
+	return raw
+}
+
+// withoutRawSizes returns schema and copies of rows without the raw_size
+// column. The cached rows are left untouched.
+func withoutRawSizes(schema bigquery.Schema, rows []map[string]interface{}) (bigquery.Schema, []map[string]interface{}) {
+	kept := make(bigquery.Schema, 0, len(schema))
+	for _, field := range schema {
+		if field.Name != "raw_size" {
+			kept = append(kept, field)
+		}
+	}
+	stripped := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row))
+		for key, value := range row {
+			if key != "raw_size" {
+				copied[key] = value
+			}
+		}
+		stripped[i] = copied
+	}
+	return kept, stripped
+}
+
+type purchaseOrderItemsResult struct {
+	items rowSet
+	err   error
+}
+
+// addPurchaseOrderItems returns copies of the metrics rows with
+// purchase_orders set to the upcoming PO items for that size, in delivery
+// order. The input rows may be cached and are left untouched.
+func addPurchaseOrderItems(rows []map[string]interface{}, items []map[string]interface{}) []map[string]interface{} {
+	bySize := make(map[string][]map[string]interface{})
+	for _, item := range items {
+		size, _ := item["size"].(string)
+		size = normalizeSize(size)
+		bySize[size] = append(bySize[size], map[string]interface{}{
+			"id":            item["id"],
+			"delivery_date": item["delivery_date"],
+			"quantity":      item["quantity"],
+		})
+	}
+
+	withItems := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row)+1)
+		for key, value := range row {
+			copied[key] = value
+		}
+		size, _ := row["size"].(string)
+		if sizeItems := bySize[size]; sizeItems != nil {
+			copied["purchase_orders"] = sizeItems
+		} else {
+			copied["purchase_orders"] = []map[string]interface{}{}
+		}
+		withItems[i] = copied
+	}
+	return withItems
+}
+
+// querySkuMetricsSingle runs the per-size metrics query for one SKU.
+func querySkuMetricsSingle(ctx context.Context, skuId string, soldMonths int) (rowSet, error) {
+	query, err := newQuery(buildSkuMetricsSingleQuery())
+	if err != nil {
+		return rowSet{}, err
+	}
+
+	// Set the SKU and sold window parameters
 	query.Parameters = []bigquery.QueryParameter{
 		{
 			Name:  "sku_id",
 			Value: skuId,
 		},
+		{
+			Name:  "sold_months",
+			Value: soldMonths,
+		},
 	}
 
-	it, err := query.Read(ctx)
+	it, err := readQuery(ctx, query)
 	if err != nil {
-		fmt.Printf("BigQuery error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to query BigQuery",
-			"details": err.Error(),
-		})
-		return
+		return rowSet{}, err
 	}
 
 	var results []map[string]interface{}
@@ -179,42 +339,33 @@ func getSkuMetricsSingle(c *gin.Context) {
 	for {
 		var values []bigquery.Value
 		err := it.Next(&values)
-		if err != nil {
-			if err.Error() == "no more items in iterator" {
-				// Normal end of iteration
-				break
-			}
-			fmt.Printf("Iterator error: %v\n", err)
+		if err == iterator.Done {
 			break
 		}
+		if err != nil {
+			loggerFrom(ctx).Error("Iterator error", "sku", skuId, "error", err)
+			return rowSet{}, err
+		}
 		rowCount++
-		fmt.Printf("=== ROW %d for SKU %s ===\n", rowCount, skuId)
+		if debugRows {
+			loggerFrom(ctx).Info("Raw row", "sku", skuId, "row", rowCount)
+		}
 		
 		// Convert to map using schema
 		row := make(map[string]interface{})
 		schema := it.Schema
 		for i, field := range schema {
 			if i < len(values) {
-				row[field.Name] = values[i]
-				fmt.Printf("  %s: %v\n", field.Name, values[i])
+				row[field.Name] = convertValue(field, values[i])
+				if debugRows {
+					loggerFrom(ctx).Info("Row field", "sku", skuId, "row", rowCount, "field", field.Name, "value", fmt.Sprint(values[i]))
+				}
 			}
 		}
 		results = append(results, row)
 	}
 
-	fmt.Printf("Returning %d size records for SKU %s\n", len(results), skuId)
-	
-	// Return 404 if no data found for this SKU
-	if len(results) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "SKU not found",
-			"sku":   skuId,
-		})
-		return
-	}
-
-	c.Header("Cache-Control", "private, max-age=300")
-	c.JSON(http.StatusOK, results)
+	return rowSet{Schema: it.Schema, Rows: results}, nil
 }
 
 // Add this route to your main router setup:
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// TestWithoutRawSizes checks that raw_size is dropped from the schema and
+// rows without touching the cached rows.
+func TestWithoutRawSizes(t *testing.T) {
+	schema := bigquery.Schema{{Name: "size"}, {Name: "raw_size"}, {Name: "available_count"}}
+	cached := []map[string]interface{}{{"size": "38.5", "raw_size": "385", "available_count": int64(3)}}
+
+	gotSchema, gotRows := withoutRawSizes(schema, cached)
+	if len(gotSchema) != 2 || gotSchema[0].Name != "size" || gotSchema[1].Name != "available_count" {
+		t.Errorf("schema = %v, want size and available_count", gotSchema)
+	}
+	if _, ok := gotRows[0]["raw_size"]; ok {
+		t.Errorf("row still has raw_size: %v", gotRows[0])
+	}
+	if gotRows[0]["size"] != "38.5" || gotRows[0]["available_count"] != int64(3) {
+		t.Errorf("row = %v, want the other columns kept", gotRows[0])
+	}
+	if cached[0]["raw_size"] != "385" {
+		t.Errorf("cached row was modified: %v", cached[0])
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+)
+
+// skuMetricsSortColumns are the columns ?sort= may name on /sku-metrics. The
+// value is spliced into ORDER BY as an identifier, so it must come from here.
+var skuMetricsSortColumns = []string{
+	"sold_last_24_months",
+	"available_count",
+	"purchased_count",
+	"open_orders_quantity",
+	"sell_through",
+	"lead_time",
+	"size_numeric",
+	"sku",
+}
+
+// skuMetricsSortedTTL is SKU_METRICS_SORTED_CACHE_TTL, or the filtered
+// query TTL.
+func skuMetricsSortedTTL() time.Duration {
+	return filteredCacheTTL("SKU_METRICS_SORTED_CACHE_TTL")
+}
+
+// respondSortedSkuMetrics serves /sku-metrics?sort=: the metrics rows
+// ordered by one of skuMetricsSortColumns in BigQuery, so ?limit= returns
+// the top N (e.g. bestsellers with sort=sold_last_24_months&order=desc)
+// without reading the whole table. ?order= is asc (default) or desc, nulls
+// sort last either way, and ties are broken by sku and size.
+func respondSortedSkuMetrics(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var v validator
+	sort := c.Query("sort")
+	if !slices.Contains(skuMetricsSortColumns, sort) {
+		v.add("sort", fmt.Sprintf("sort must be one of %s", strings.Join(skuMetricsSortColumns, ", ")))
+	}
+	order := strings.ToLower(c.DefaultQuery("order", "asc"))
+	if order != "asc" && order != "desc" {
+		v.add("order", "order must be asc or desc")
+	}
+	page := parsePagination(c, &v)
+	if v.respond(c) {
+		return
+	}
+
+	// ?list= is applied in SQL so the limit counts only listed SKUs
+	var skus []string
+	if name := c.Query("list"); name != "" {
+		list, ok := getSkuList(name)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "SKU list not found",
+				"list":  name,
+			})
+			return
+		}
+		skus = list
+	}
+
+	sql := skuMetricsSelectSQL
+	if skus != nil {
+		sql += "WHERE sku IN UNNEST(@skus)\n"
+	}
+	sql += fmt.Sprintf("ORDER BY %s %s NULLS LAST, sku, size_numeric\n%s", sort, strings.ToUpper(order), page.clause())
+
+	key := fmt.Sprintf("sorted:%s:%s:%d:%d:%s", sort, order, page.Limit, page.Offset, strings.Join(skus, ","))
+	queryStart := time.Now()
+	value, hit, err := skuMetricsCache.fetch(ctx, key, skuMetricsSortedTTL(), func() (interface{}, error) {
+		query, err := newQuery(sql)
+		if err != nil {
+			return nil, err
+		}
+		query.Parameters = page.parameters()
+		if skus != nil {
+			query.Parameters = append(query.Parameters, bigquery.QueryParameter{Name: "skus", Value: skus})
+		}
+		it, err := readQuery(detachedContext(ctx), query)
+		if err != nil {
+			return nil, err
+		}
+		return readSkuMetricsRows(ctx, it)
+	})
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	results := value.(rowSet)
+	c.Set(queryTimeKey, time.Since(queryStart))
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+
+	loggerFrom(ctx).Info("Returning sorted SKU metrics", "sort", sort, "order", order, "rows", len(results.Rows))
+	page.setLinkHeader(c, len(results.Rows), -1)
+	c.Header("Cache-Control", "private, max-age=300")
+	respondRows(c, http.StatusOK, results.Schema, results.Rows)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// skuMetricsColumns is the column list of querySkuMetrics, in order. The
+// Storage Read API path projects table rows onto it so both paths return the
+// same shape.
+var skuMetricsColumns = []string{
+	"sku", "name", "category", "cluster", "gender", "imageUrl", "lead_time",
+	"purchase_price", "class", "size", "size_numeric", "available_count",
+	"purchased_count", "sold_last_24_months", "sell_through",
+	"open_orders_quantity", "has_half_sizes", "is_mto", "season", "product_id",
+	"sold_january", "sold_february", "sold_march", "sold_april", "sold_may",
+	"sold_june", "sold_july", "sold_august", "sold_september", "sold_october",
+	"sold_november", "sold_december",
+}
+
+// skuMetricsComputed are the columns querySkuMetrics computes in SQL, done in
+// Go for table reads.
+var skuMetricsComputed = map[string]func(row map[string]interface{}) interface{}{
+	// SAFE_CAST(size AS FLOAT64)
+	"size_numeric": func(row map[string]interface{}) interface{} {
+		size, _ := row["size"].(string)
+		if value, err := strconv.ParseFloat(size, 64); err == nil {
+			return value
+		}
+		return nil
+	},
+	// SAFE_DIVIDE(sold_last_24_months, sold_last_24_months + available_count)
+	"sell_through": func(row map[string]interface{}) interface{} {
+		sold, soldOK := numericValue(row["sold_last_24_months"])
+		available, availableOK := numericValue(row["available_count"])
+		if !soldOK || !availableOK || sold+available == 0 {
+			return nil
+		}
+		return sold / (sold + available)
+	},
+}
+
+// skuMetricsReadAPI picks how /sku-metrics reads the table: "query" (the
+// default) runs querySkuMetrics as a query job, "storage" reads the table
+// directly through the BigQuery Storage Read API, which is faster and avoids
+// query costs for the full dump. Set via SKU_METRICS_READ_API.
+func skuMetricsReadAPI() string {
+	if os.Getenv("SKU_METRICS_READ_API") == "storage" {
+		return "storage"
+	}
+	return "query"
+}
+
+// storageReadEnabled reports whether any endpoint reads through the Storage
+// Read API, in which case the client needs a read client. Once enabled, the
+// client library also uses it for query results spanning several pages.
+func storageReadEnabled() bool {
+	return skuMetricsReadAPI() == "storage"
+}
+
+// readSkuMetricsTable reads agent.sku_sizes_metrics in full via the Storage
+// Read API. If a read session can't be created the client library falls back
+// to the tabledata API on its own.
+func readSkuMetricsTable(ctx context.Context) (rowSet, error) {
+	table, err := tableRef("agent", "sku_sizes_metrics")
+	if err != nil {
+		return rowSet{}, err
+	}
+	recordExplainedTableRead(ctx, table)
+
+	it := table.Read(ctx)
+	var tableSchema map[string]*bigquery.FieldSchema
+	var results []map[string]interface{}
+	for {
+		var values []bigquery.Value
+		err := it.Next(&values)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			bqClient.reportResult(err)
+			return rowSet{}, err
+		}
+		if tableSchema == nil {
+			tableSchema = make(map[string]*bigquery.FieldSchema, len(it.Schema))
+			for _, field := range it.Schema {
+				tableSchema[field.Name] = field
+			}
+		}
+
+		raw := make(map[string]interface{}, len(values))
+		for i, field := range it.Schema {
+			if i < len(values) {
+				raw[field.Name] = convertValue(field, values[i])
+			}
+		}
+		row := make(map[string]interface{}, len(skuMetricsColumns))
+		for _, name := range skuMetricsColumns {
+			if compute, ok := skuMetricsComputed[name]; ok {
+				row[name] = compute(raw)
+			} else {
+				row[name] = raw[name]
+			}
+		}
+		results = append(results, row)
+	}
+	bqClient.reportResult(nil)
+
+	schema, err := skuMetricsSchema(tableSchema)
+	if err != nil {
+		return rowSet{}, err
+	}
+	fmt.Printf("Read %d SKU metrics rows via the Storage Read API (accelerated: %t)\n", len(results), it.IsAccelerated())
+	return rowSet{Schema: schema, Rows: results}, nil
+}
+
+// skuMetricsSchema builds the schema of skuMetricsColumns from the table
+// schema, adding the computed columns as FLOAT. A column missing from the
+// table is reported like a query hitting schema drift.
+func skuMetricsSchema(tableSchema map[string]*bigquery.FieldSchema) (bigquery.Schema, error) {
+	schema := make(bigquery.Schema, 0, len(skuMetricsColumns))
+	for _, name := range skuMetricsColumns {
+		if _, ok := skuMetricsComputed[name]; ok {
+			schema = append(schema, &bigquery.FieldSchema{Name: name, Type: bigquery.FloatFieldType})
+			continue
+		}
+		field, ok := tableSchema[name]
+		if !ok && tableSchema != nil {
+			return nil, fmt.Errorf("table read failed: Unrecognized name: %s", name)
+		}
+		if !ok {
+			// Empty table, no schema to copy from
+			field = &bigquery.FieldSchema{Name: name, Type: bigquery.StringFieldType}
+		}
+		schema = append(schema, field)
+	}
+	return schema, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+// normalizeSkuID returns the canonical form of a SKU entered by a client:
+// trimmed and uppercase, which is how the source systems store SKUs, so
+// "abc123def " finds ABC123DEF. SKU_CASE=preserve skips the uppercasing for
+// data with legitimately mixed-case SKUs.
+func normalizeSkuID(sku string) string {
+	sku = strings.TrimSpace(sku)
+	if os.Getenv("SKU_CASE") == "preserve" {
+		return sku
+	}
+	return strings.ToUpper(sku)
+}
+
+// skuExists reports whether the base SKU is known in the products table,
+// regardless of whether it has any inventory, sales or orders.
+func skuExists(ctx context.Context, skuId string) (bool, error) {
+	query, err := newQuery(`
+		SELECT 1
+		FROM metal-force-400307.staging.stg_shopify__products_variant
+		WHERE base_sku = @sku_id
+		LIMIT 1
+	`)
+	if err != nil {
+		return false, err
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "sku_id",
+			Value: skuId,
+		},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return false, err
+	}
+
+	var values []bigquery.Value
+	err = it.Next(&values)
+	if err == iterator.Done {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// existingSkus checks a batch of base SKUs against the products table in a
+// single query and returns the ones that exist.
+func existingSkus(ctx context.Context, skus []string) (map[string]bool, error) {
+	query, err := newQuery(`
+		SELECT DISTINCT base_sku
+		FROM metal-force-400307.staging.stg_shopify__products_variant
+		WHERE base_sku IN UNNEST(@skus)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "skus",
+			Value: skus,
+		},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(skus))
+	for {
+		var row struct {
+			BaseSku string `bigquery:"base_sku"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing[row.BaseSku] = true
+	}
+	return existing, nil
+}
+
+// getSkuExists is a cheap existence check for form validation, so clients
+// don't have to run the full single-SKU metrics query just to validate input.
+func getSkuExists(c *gin.Context) {
+	skuId := normalizeSkuID(c.Param("sku_id"))
+	loggerFrom(c.Request.Context()).Info("SKU existence check", "sku", skuId)
+
+	exists, err := skuExists(c.Request.Context(), skuId)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"sku":    skuId,
+		"exists": exists,
+	})
+}
+
+const (
+	minSkuSearchPrefix    = 3
+	defaultSkuSearchLimit = 20
+	maxSkuSearchLimit     = 100
+)
+
+// skuPrefixPattern matches the start of a base SKU, at least
+// minSkuSearchPrefix characters so a search never scans every product.
+var skuPrefixPattern = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9_-]{%d,9}$`, minSkuSearchPrefix))
+
+// getSkuSearch serves GET /skus/search?prefix=: the base SKUs starting with
+// prefix, for autocomplete. ?limit= caps the results, defaulting to
+// SKU_SEARCH_LIMIT or 20, at most 100.
+func getSkuSearch(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var v validator
+	prefix := normalizeSkuID(c.Query("prefix"))
+	if !skuPrefixPattern.MatchString(prefix) {
+		v.add("prefix", fmt.Sprintf("prefix must be %d to 9 SKU characters", minSkuSearchPrefix))
+	}
+	limit := envInt("SKU_SEARCH_LIMIT", defaultSkuSearchLimit)
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSkuSearchLimit {
+			v.add("limit", fmt.Sprintf("limit must be an integer between 1 and %d", maxSkuSearchLimit))
+		}
+		limit = n
+	}
+	if v.respond(c) {
+		return
+	}
+
+	loggerFrom(ctx).Info("SKU search", "prefix", prefix, "limit", limit)
+	query, err := newQuery(`
+		SELECT DISTINCT base_sku
+		FROM metal-force-400307.staging.stg_shopify__products_variant
+		WHERE STARTS_WITH(base_sku, @prefix)
+		ORDER BY base_sku
+		LIMIT @limit
+	`)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{Name: "prefix", Value: prefix},
+		{Name: "limit", Value: limit},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	skus := []string{}
+	for {
+		var row struct {
+			BaseSku string `bigquery:"base_sku"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		skus = append(skus, row.BaseSku)
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"prefix": prefix,
+		"skus":   skus,
+	})
+}
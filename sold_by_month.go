@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/iterator"
+)
+
+// soldMonthColumns are the month-name pivot columns of the single-SKU query.
+// They merge the same month of different years, so ?monthly=year_month
+// replaces them with sold_by_month.
+var soldMonthColumns = []string{
+	"sold_january", "sold_february", "sold_march", "sold_april", "sold_may",
+	"sold_june", "sold_july", "sold_august", "sold_september", "sold_october",
+	"sold_november", "sold_december",
+}
+
+// buildSoldByMonthQuery returns units sold per size and calendar month
+// (YYYY-MM) for a base SKU over the last @sold_months months, with sizes
+// normalized like the metrics query so the two join on size.
+func buildSoldByMonthQuery() string {
+	return `
+		SELECT
+		  ` + normalizedSizeSQL("a.size") + ` AS size,
+		  a.year_month,
+		  SUM(a.item_quantity) AS sold
+		FROM (
+		  SELECT
+		    SUBSTRING(v.sku, 10) AS size,
+		    FORMAT_DATE('%Y-%m', EXTRACT(DATE FROM o.created_at)) AS year_month,
+		    o.item_quantity
+		  FROM metal-force-400307.staging.stg_shopify__orders_items o
+		  LEFT JOIN metal-force-400307.staging.stg_shopify__products_variant v ON o.variant_id = v.id
+		  WHERE EXTRACT(DATE FROM o.created_at) >= DATE_SUB(CURRENT_DATE(), INTERVAL @sold_months MONTH)
+		  AND v.base_sku = @sku_id
+		) a
+		GROUP BY 1, 2
+	`
+}
+
+// querySoldByMonth returns units sold keyed by size, then by YYYY-MM.
+func querySoldByMonth(ctx context.Context, skuId string, soldMonths int) (map[string]map[string]int64, error) {
+	query, err := newQuery(buildSoldByMonthQuery())
+	if err != nil {
+		return nil, err
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "sku_id",
+			Value: skuId,
+		},
+		{
+			Name:  "sold_months",
+			Value: soldMonths,
+		},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	sold := make(map[string]map[string]int64)
+	for {
+		var row struct {
+			Size      bigquery.NullString `bigquery:"size"`
+			YearMonth string              `bigquery:"year_month"`
+			Sold      bigquery.NullInt64  `bigquery:"sold"`
+		}
+		err := it.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		size := row.Size.StringVal
+		if sold[size] == nil {
+			sold[size] = make(map[string]int64)
+		}
+		sold[size][row.YearMonth] += row.Sold.Int64
+	}
+	return sold, nil
+}
+
+// soldWindowMonths lists the YYYY-MM months the sold window touches, oldest
+// first, matching BigQuery's CURRENT_DATE() in UTC.
+func soldWindowMonths(soldMonths int, now time.Time) []string {
+	now = now.UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	months := make([]string, 0, soldMonths+1)
+	for i := soldMonths; i >= 0; i-- {
+		months = append(months, current.AddDate(0, -i, 0).Format("2006-01"))
+	}
+	return months
+}
+
+// addSoldByMonth returns copies of the metrics rows with sold_by_month set
+// to the units sold per YYYY-MM, zero-filled over the whole window, in place
+// of the month-name pivot columns. The input rows may be cached and are left
+// untouched.
+func addSoldByMonth(rows []map[string]interface{}, sold map[string]map[string]int64, months []string) []map[string]interface{} {
+	withMonths := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row))
+		for key, value := range row {
+			copied[key] = value
+		}
+		for _, column := range soldMonthColumns {
+			delete(copied, column)
+		}
+		size, _ := row["size"].(string)
+		byMonth := make(map[string]int64, len(months))
+		for _, month := range months {
+			byMonth[month] = sold[size][month]
+		}
+		copied["sold_by_month"] = byMonth
+		withMonths[i] = copied
+	}
+	return withMonths
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sizeStockGap is one size in the gap response.
+type sizeStockGap struct {
+	Size           string  `json:"size"`
+	Target         float64 `json:"target"`
+	AvailableCount float64 `json:"available_count"`
+	OnOrder        float64 `json:"on_order"`
+	Gap            float64 `json:"gap"`
+	NeedsOrder     bool    `json:"needs_order"`
+}
+
+// postSkuStockGap serves POST /sku-metrics/:sku_id/gap. The body maps sizes
+// to target stock levels, e.g. {"M": 40, "L": 25}, and each size gets
+//
+//	gap = target - available_count - on_order
+//
+// where on_order is purchased_count, the units on open purchase orders. A
+// positive gap means the size needs ordering. Sizes the SKU doesn't carry
+// are rejected.
+func postSkuStockGap(c *gin.Context) {
+	skuId := normalizeSkuID(c.Param("sku_id"))
+	ctx := c.Request.Context()
+
+	var targets map[string]float64
+	if err := c.ShouldBindJSON(&targets); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid targets body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(targets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid targets body",
+			"details": "body must map at least one size to a target stock level",
+		})
+		return
+	}
+	for size, target := range targets {
+		if target < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid target",
+				"size":    size,
+				"details": "targets must not be negative",
+			})
+			return
+		}
+	}
+
+	loggerFrom(ctx).Info("Stock gap requested", "sku", skuId, "sizes", len(targets))
+
+	metrics, _, err := fetchSkuMetricsSingle(ctx, skuId, defaultSoldMonths)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if len(metrics.Rows) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "SKU not found",
+			"sku":   skuId,
+		})
+		return
+	}
+
+	bySize := make(map[string]map[string]interface{}, len(metrics.Rows))
+	for _, row := range metrics.Rows {
+		if size, ok := row["size"].(string); ok {
+			bySize[size] = row
+		}
+	}
+
+	var unknown []string
+	for size := range targets {
+		if _, ok := bySize[size]; !ok {
+			unknown = append(unknown, size)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown sizes for SKU",
+			"sku":   skuId,
+			"sizes": unknown,
+		})
+		return
+	}
+
+	sizes := make([]sizeStockGap, 0, len(targets))
+	for size, target := range targets {
+		row := bySize[size]
+		available, _ := numericValue(row["available_count"])
+		onOrder, _ := numericValue(row["purchased_count"])
+		gap := target - available - onOrder
+		sizes = append(sizes, sizeStockGap{
+			Size:           size,
+			Target:         target,
+			AvailableCount: available,
+			OnOrder:        onOrder,
+			Gap:            gap,
+			NeedsOrder:     gap > 0,
+		})
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		return sizeLess(sizes[i].Size, sizes[j].Size)
+	})
+
+	respondJSON(c, http.StatusOK, gin.H{
+		"sku":   skuId,
+		"sizes": sizes,
+	})
+}
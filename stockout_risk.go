@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	defaultMinStockoutRisk = 0.5
+	daysPerMonth           = 365.0 / 12
+)
+
+// sizeStockoutRisk is one size in the stockout-risk response, with every
+// input of the formula so buyers can check the score. open_orders_quantity
+// predates open_orders_units and is kept for existing clients; like in the
+// single-SKU response it counts order lines, not units.
+type sizeStockoutRisk struct {
+	Size                   string   `json:"size"`
+	Risk                   float64  `json:"risk"`
+	AvailableCount         float64  `json:"available_count"`
+	OpenOrdersQuantity     float64  `json:"open_orders_quantity"`
+	OpenOrdersUnits        float64  `json:"open_orders_units"`
+	PurchasedCount         float64  `json:"purchased_count"`
+	NetStock               float64  `json:"net_stock"`
+	DailyDemand            float64  `json:"daily_demand"`
+	ExpectedLeadTimeDemand float64  `json:"expected_lead_time_demand"`
+	DaysOfCover            *float64 `json:"days_of_cover"`
+}
+
+// getSkuStockoutRisk serves GET /sku-metrics/:sku_id/stockout-risk. For each
+// size it estimates the probability of selling out before a reorder placed
+// today would arrive:
+//
+//	daily_demand = sold over the ?sold_months= window / days in the window
+//	net_stock    = available_count - open_orders_units
+//	risk         = P(Poisson(daily_demand * lead_time_days) > net_stock)
+//
+// Incoming purchase orders (purchased_count) are reported but not counted,
+// since their arrival may fall after the lead time. lead_time from the
+// metrics table is read as days and can be overridden via ?lead_time_days=.
+// Only sizes with risk >= ?min_risk= (default 0.5) are returned, highest
+// risk first. Unknown SKUs get a 404; a known SKU with no lead time and no
+// ?lead_time_days= gets a 422.
+func getSkuStockoutRisk(c *gin.Context) {
+	skuId := normalizeSkuID(c.Param("sku_id"))
+	ctx := c.Request.Context()
+	loggerFrom(ctx).Info("Stockout risk requested", "sku", skuId)
+
+	var v validator
+	soldMonths := parseSoldMonths(c, &v, "STOCKOUT_RISK_MAX_SOLD_MONTHS")
+
+	minRisk := defaultMinStockoutRisk
+	if value := c.Query("min_risk"); value != "" {
+		var err error
+		minRisk, err = strconv.ParseFloat(value, 64)
+		if err != nil || minRisk < 0 || minRisk > 1 {
+			v.add("min_risk", "min_risk must be a number between 0 and 1")
+		}
+	}
+
+	var leadTimeDays float64
+	leadTimeValue := c.Query("lead_time_days")
+	if leadTimeValue != "" {
+		var err error
+		leadTimeDays, err = strconv.ParseFloat(leadTimeValue, 64)
+		if err != nil || leadTimeDays <= 0 {
+			v.add("lead_time_days", "lead_time_days must be a positive number")
+		}
+	}
+	if v.respond(c) {
+		return
+	}
+
+	if leadTimeValue == "" {
+		leadTime, err := queryLeadTime(ctx, skuId)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		if leadTime == nil {
+			// An unknown SKU has no lead time either; tell the two apart
+			// so a typo isn't reported as missing data
+			exists, err := skuExists(ctx, skuId)
+			if err != nil {
+				respondQueryError(c, err)
+				return
+			}
+			if !exists {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error":  "SKU not found",
+					"sku":    skuId,
+					"exists": false,
+				})
+				return
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "No lead time for SKU",
+				"sku":     skuId,
+				"details": "pass ?lead_time_days= to score this SKU",
+			})
+			return
+		}
+		leadTimeDays = *leadTime
+	}
+
+	metrics, _, err := fetchSkuMetricsSingle(ctx, skuId, soldMonths)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	if len(metrics.Rows) == 0 {
+		exists, err := skuExists(ctx, skuId)
+		if err != nil {
+			respondQueryError(c, err)
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "SKU not found",
+				"sku":    skuId,
+				"exists": false,
+			})
+			return
+		}
+	}
+
+	windowDays := float64(soldMonths) * daysPerMonth
+	sizes := []sizeStockoutRisk{}
+	for _, row := range metrics.Rows {
+		risk := scoreStockoutRisk(row, windowDays, leadTimeDays)
+		if risk.Risk >= minRisk {
+			sizes = append(sizes, risk)
+		}
+	}
+	sort.SliceStable(sizes, func(i, j int) bool {
+		return sizes[i].Risk > sizes[j].Risk
+	})
+
+	loggerFrom(ctx).Info("Returning at-risk sizes", "sku", skuId, "sizes", len(sizes))
+	respondJSON(c, http.StatusOK, gin.H{
+		"sku":            skuId,
+		"lead_time_days": leadTimeDays,
+		"sold_months":    soldMonths,
+		"min_risk":       minRisk,
+		"sizes":          sizes,
+	})
+}
+
+func scoreStockoutRisk(row map[string]interface{}, windowDays, leadTimeDays float64) sizeStockoutRisk {
+	size, _ := row["size"].(string)
+	available, _ := numericValue(row["available_count"])
+	openOrders, _ := numericValue(row["open_orders_units"])
+	openOrderLines, _ := numericValue(row["open_orders_quantity"])
+	purchased, _ := numericValue(row["purchased_count"])
+	sold, _ := numericValue(row["sold_last_24_months"])
+
+	dailyDemand := sold / windowDays
+	netStock := available - openOrders
+	expected := dailyDemand * leadTimeDays
+
+	risk := sizeStockoutRisk{
+		Size:                   size,
+		Risk:                   math.Round(poissonExceeds(netStock, expected)*1000) / 1000,
+		AvailableCount:         available,
+		OpenOrdersQuantity:     openOrderLines,
+		OpenOrdersUnits:        openOrders,
+		PurchasedCount:         purchased,
+		NetStock:               netStock,
+		DailyDemand:            math.Round(dailyDemand*1000) / 1000,
+		ExpectedLeadTimeDemand: math.Round(expected*100) / 100,
+	}
+	if dailyDemand > 0 {
+		cover := math.Round(math.Max(netStock, 0)/dailyDemand*10) / 10
+		risk.DaysOfCover = &cover
+	}
+	return risk
+}
+
+// poissonExceeds returns P(X > stock) for X ~ Poisson(mean). Large means use
+// the normal approximation, where the exact sum would underflow.
+func poissonExceeds(stock, mean float64) float64 {
+	if stock < 0 {
+		return 1
+	}
+	if mean <= 0 {
+		return 0
+	}
+	k := math.Floor(stock)
+	if mean > 100 {
+		z := (k + 0.5 - mean) / math.Sqrt(mean)
+		return 0.5 * math.Erfc(z/math.Sqrt2)
+	}
+
+	term := math.Exp(-mean)
+	cdf := term
+	for i := 1.0; i <= k; i++ {
+		term *= mean / i
+		cdf += term
+	}
+	return math.Max(0, 1-cdf)
+}
+
+// queryLeadTime returns the lead_time of a SKU from the metrics table, or nil
+// if it has none.
+func queryLeadTime(ctx context.Context, skuId string) (*float64, error) {
+	query, err := newQuery(`
+		SELECT MAX(SAFE_CAST(lead_time AS FLOAT64)) AS lead_time
+		FROM metal-force-400307.agent.sku_sizes_metrics
+		WHERE sku = @sku_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	query.Parameters = []bigquery.QueryParameter{
+		{
+			Name:  "sku_id",
+			Value: skuId,
+		},
+	}
+
+	it, err := readQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var row struct {
+		LeadTime bigquery.NullFloat64 `bigquery:"lead_time"`
+	}
+	err = it.Next(&row)
+	if err == iterator.Done || (err == nil && !row.LeadTime.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &row.LeadTime.Float64, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tableMetadataCache keeps table metadata briefly so conditional requests
+// don't cost a metadata call each.
+var tableMetadataCache = newResultCache("table_metadata")
+
+// tableLastModified returns when BigQuery last modified dataset.table.
+func tableLastModified(ctx context.Context, dataset, table string) (time.Time, error) {
+	value, _, err := tableMetadataCache.fetch(ctx, dataset+"."+table, time.Minute, func() (interface{}, error) {
+		metadata, err := bqClient.get().Dataset(dataset).Table(table).Metadata(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return metadata.LastModifiedTime, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return value.(time.Time), nil
+}
+
+// notModifiedSince sets Last-Modified and reports whether the client's
+// If-Modified-Since copy is still current, in which case the caller should
+// answer 304. HTTP dates have second precision, so the comparison is too.
+func notModifiedSince(c *gin.Context, lastModified time.Time) bool {
+	lastModified = lastModified.UTC().Truncate(time.Second)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	ifModifiedSince := c.GetHeader("If-Modified-Since")
+	if ifModifiedSince == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
@@ -0,0 +1,32 @@
+
+		WITH latest_inventory_date AS (
+		  SELECT MAX(date) AS max_date
+		  FROM metal-force-400307.staging.stg_xentral__inventory
+		  WHERE warehouse IS NOT NULL
+		)
+		SELECT
+		  CASE
+		    WHEN a.size IS NULL OR TRIM(a.size) IN ('', '0') THEN 'ONE SIZE'
+		    WHEN a.size = '385' THEN '38.5'
+		    WHEN a.size = '395' THEN '39.5'
+		    WHEN a.size = '425' THEN '42.5'
+		    WHEN a.size = '435' THEN '43.5'
+		    ELSE a.size
+		  END AS size,
+		  a.warehouse,
+		  a.quantity
+		FROM (
+		  SELECT
+		      v.size,
+		      i.warehouse,
+		      SUM(i.quantity) AS quantity
+		  FROM metal-force-400307.staging.stg_shopify__products_variant v
+		  JOIN metal-force-400307.staging.stg_xentral__products p ON v.sku = p.sku
+		  JOIN metal-force-400307.staging.stg_xentral__inventory i ON p.id = i.product_id
+		  CROSS JOIN latest_inventory_date lid
+		  WHERE i.warehouse IS NOT NULL
+		  AND i.date = lid.max_date
+		  AND v.base_sku = @sku_id
+		  GROUP BY 1, 2
+		) a
+	
\ No newline at end of file
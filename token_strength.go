@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultMinTokenLength = 32
+
+// weakTokens are values that have been, or are likely to be, deployed by
+// mistake. They are compared case-insensitively.
+var weakTokens = map[string]bool{
+	"token":     true,
+	"secret":    true,
+	"password":  true,
+	"changeme":  true,
+	"test":      true,
+	"admin":     true,
+	"apitoken":  true,
+	"api_token": true,
+	"12345678":  true,
+}
+
+// minTokenLength is API_TOKEN_MIN_LENGTH, defaulting to 32 characters.
+func minTokenLength() int {
+	if value := os.Getenv("API_TOKEN_MIN_LENGTH"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+		fmt.Printf("WARNING: Ignoring invalid API_TOKEN_MIN_LENGTH: %s\n", value)
+	}
+	return defaultMinTokenLength
+}
+
+// tokenWeakness explains why token is too weak, or returns "" if it is fine.
+func tokenWeakness(token string, minLength int) string {
+	if weakTokens[strings.ToLower(token)] {
+		return "it is a known weak value"
+	}
+	if len(token) < minLength {
+		return fmt.Sprintf("it is %d characters, the minimum is %d", len(token), minLength)
+	}
+	return ""
+}
+
+// checkTokenStrength validates every configured token at startup. A weak
+// token refuses to start in production and only warns elsewhere, so local
+// setups can keep short tokens.
+func checkTokenStrength(env string) {
+	minLength := minTokenLength()
+
+	for token, entry := range apiTokens {
+		weakness := tokenWeakness(token, minLength)
+		if weakness == "" {
+			continue
+		}
+		if env == "production" {
+			panic(fmt.Sprintf("Refusing to start: %s is too weak, %s", entry.Alias, weakness))
+		}
+		fmt.Printf("WARNING: %s is too weak, %s. This would refuse to start in production!\n", entry.Alias, weakness)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gin-gonic/gin"
+)
+
+// rowTransformer post-processes a single result row. Rows handed to a
+// transformer are private copies, so it may modify and return the same map.
+type rowTransformer func(map[string]interface{}) map[string]interface{}
+
+// rowTransformerFactories are the transformers clients can pick with
+// ?transform=a,b,c. Each factory gets the result schema so transformers can
+// act on column types rather than guessing from values.
+var rowTransformerFactories = map[string]func(bigquery.Schema) rowTransformer{
+	"size":              func(bigquery.Schema) rowTransformer { return normalizeSizeField },
+	"null_to_zero":      nullToZero,
+	"camel_case":        func(bigquery.Schema) rowTransformer { return camelCaseKeys },
+	"weighted_velocity": weightedVelocity,
+}
+
+// parseRowTransformers resolves ?transform= into the pipeline to run, in the
+// order given by the client.
+func parseRowTransformers(c *gin.Context, schema bigquery.Schema) ([]rowTransformer, error) {
+	value := c.Query("transform")
+	if value == "" {
+		return nil, nil
+	}
+
+	var transformers []rowTransformer
+	for _, name := range strings.Split(value, ",") {
+		factory, ok := rowTransformerFactories[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+		transformers = append(transformers, factory(schema))
+	}
+	return transformers, nil
+}
+
+// applyRowTransformers runs the pipeline over copies of rows, leaving the
+// originals (which may be cached) untouched.
+func applyRowTransformers(rows []map[string]interface{}, transformers []rowTransformer) []map[string]interface{} {
+	transformed := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		copied := make(map[string]interface{}, len(row))
+		for key, value := range row {
+			copied[key] = value
+		}
+		for _, transform := range transformers {
+			copied = transform(copied)
+		}
+		transformed[i] = copied
+	}
+	return transformed
+}
+
+func normalizeSizeField(row map[string]interface{}) map[string]interface{} {
+	if size, ok := row["size"].(string); ok {
+		row["size"] = normalizeSize(size)
+	}
+	return row
+}
+
+// nullToZero replaces nulls in numeric columns with 0, like the COALESCEs in
+// the single-SKU query do.
+func nullToZero(schema bigquery.Schema) rowTransformer {
+	return func(row map[string]interface{}) map[string]interface{} {
+		for _, field := range schema {
+			if row[field.Name] != nil {
+				continue
+			}
+			switch field.Type {
+			case bigquery.IntegerFieldType:
+				row[field.Name] = int64(0)
+			case bigquery.FloatFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+				row[field.Name] = float64(0)
+			}
+		}
+		return row
+	}
+}
+
+func camelCaseKeys(row map[string]interface{}) map[string]interface{} {
+	camel := make(map[string]interface{}, len(row))
+	for key, value := range row {
+		camel[camelCase(key)] = value
+	}
+	return camel
+}
+
+// camelCase turns snake_case column names into camelCase,
+// e.g. sold_last_24_months becomes soldLast24Months.
+func camelCase(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
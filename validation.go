@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paramError is one problem with a request parameter.
+type paramError struct {
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+// validator collects every problem with a request's parameters, so clients
+// can fix them all in one round-trip instead of one error at a time.
+type validator struct {
+	errors []paramError
+}
+
+func (v *validator) add(param, message string) {
+	v.errors = append(v.errors, paramError{Param: param, Message: message})
+}
+
+// check records err against param if it is non-nil.
+func (v *validator) check(param string, err error) {
+	if err != nil {
+		v.add(param, err.Error())
+	}
+}
+
+// respond writes a 400 listing every collected problem in details and
+// reports whether it did. Handlers return when it is true.
+func (v *validator) respond(c *gin.Context) bool {
+	if len(v.errors) == 0 {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid request parameters",
+		"details": v.errors,
+	})
+	return true
+}
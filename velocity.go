@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+const defaultVelocityDecay = 0.85
+
+// velocityDecay is the per-month weight factor for weighted_sold_velocity,
+// configurable via SOLD_VELOCITY_DECAY in (0, 1]. Lower values favour recent
+// months more strongly; 1 gives the plain monthly average.
+func velocityDecay() float64 {
+	value := os.Getenv("SOLD_VELOCITY_DECAY")
+	if value == "" {
+		return defaultVelocityDecay
+	}
+	decay, err := strconv.ParseFloat(value, 64)
+	if err != nil || decay <= 0 || decay > 1 {
+		fmt.Printf("WARNING: Ignoring invalid SOLD_VELOCITY_DECAY: %s\n", value)
+		return defaultVelocityDecay
+	}
+	return decay
+}
+
+// weightedVelocity is the weighted_velocity transformer. It adds
+// weighted_sold_velocity, the recency-weighted monthly demand over the
+// sold_<month> fields: the last complete month has weight 1, the one before
+// decay, then decay^2 and so on back eleven months. The current month is
+// incomplete and left out. It reads the snake_case fields, so it must run
+// before camel_case.
+func weightedVelocity(bigquery.Schema) rowTransformer {
+	decay := velocityDecay()
+
+	return func(row map[string]interface{}) map[string]interface{} {
+		month := time.Now().Month()
+		var weighted, weights float64
+		found := false
+		for monthsAgo := 0; monthsAgo < 11; monthsAgo++ {
+			month = previousMonth(month)
+			sold, ok := numericValue(row["sold_"+strings.ToLower(month.String())])
+			if !ok {
+				continue
+			}
+			weight := math.Pow(decay, float64(monthsAgo))
+			weighted += weight * sold
+			weights += weight
+			found = true
+		}
+		if found {
+			row["weighted_sold_velocity"] = math.Round(weighted/weights*100) / 100
+		} else {
+			row["weighted_sold_velocity"] = nil
+		}
+		return row
+	}
+}
+
+func previousMonth(month time.Month) time.Month {
+	if month == time.January {
+		return time.December
+	}
+	return month - 1
+}
+
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}